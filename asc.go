@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ascDateLayout is the layout of the date line and the trigger block start
+// of Vector ASC files, e.g. "Thu Oct 16 11:23:45.123 pm 2026".
+const ascDateLayout = "Mon Jan 2 03:04:05.000 pm 2006"
+
+// ascDateLayouts are the date layouts accepted when reading ASC files.
+var ascDateLayouts = []string{
+	ascDateLayout,
+	"Mon Jan 2 03:04:05 pm 2006",
+	"Mon Jan 2 15:04:05.000 2006",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+// ascWriter writes messages in the Vector ASCII log format. Timestamps are
+// relative to the first message and channels are numbered from 1 in the
+// order they appear.
+type ascWriter struct {
+	w        *bufio.Writer
+	start    time.Time
+	channels map[string]int
+}
+
+func newASCWriter(w io.Writer) traceWriter {
+	return &ascWriter{w: bufio.NewWriter(w), channels: make(map[string]int)}
+}
+
+// writeHeader writes the file header with the start time of the measurement.
+func (a *ascWriter) writeHeader(start time.Time) {
+	a.start = start
+	date := start.Format(ascDateLayout)
+	fmt.Fprintf(a.w, "date %s\n", date)
+	fmt.Fprintf(a.w, "base hex  timestamps absolute\n")
+	fmt.Fprintf(a.w, "internal events logged\n")
+	fmt.Fprintf(a.w, "// version 13.0.0\n")
+	fmt.Fprintf(a.w, "Begin Triggerblock %s\n", date)
+	fmt.Fprintf(a.w, "   0.000000 Start of measurement\n")
+}
+
+// channel returns the ASC channel number of a channel name.
+func (a *ascWriter) channel(name string) int {
+	n, ok := a.channels[name]
+	if !ok {
+		n = len(a.channels) + 1
+		a.channels[name] = n
+		fmt.Fprintf(a.w, "// channel %d: %s\n", n, name)
+	}
+	return n
+}
+
+func (a *ascWriter) WriteMessage(msg CANMessage) error {
+	if a.start.IsZero() {
+		a.writeHeader(msg.Timestamp)
+	}
+	channel := a.channel(msg.Channel)
+	offset := msg.Timestamp.Sub(a.start).Seconds()
+	frame := msg.Frame
+
+	direction := "Rx"
+	if msg.Direction == "TX" {
+		direction = "Tx"
+	}
+	id := fmt.Sprintf("%X", frame.ID)
+	if frame.IsExtended {
+		id += "x"
+	}
+	data := make([]string, len(frame.Payload()))
+	for i, b := range frame.Payload() {
+		data[i] = fmt.Sprintf("%02X", b)
+	}
+
+	var err error
+	switch {
+	case frame.IsError:
+		_, err = fmt.Fprintf(a.w, "%11.6f %d  ErrorFrame\n", offset, channel)
+	case frame.IsFD:
+		_, err = fmt.Fprintf(a.w, "%11.6f CANFD %3d %-4s %8s %32s %d %d %x %2d %s %8d %4d %8X %8d %8d %8d %8d %8d\n",
+			offset, channel, direction, id, "", boolToInt(frame.BRS), boolToInt(frame.ESI), frame.DLC(), frame.Length,
+			strings.Join(data, " "), 0, 0, ascFDFlags(frame), 0, 0, 0, 0, 0)
+	case frame.IsRemote:
+		_, err = fmt.Fprintf(a.w, "%11.6f %d  %-15s %-4s r %x\n", offset, channel, id, direction, frame.Length)
+	default:
+		_, err = fmt.Fprintf(a.w, "%11.6f %d  %-15s %-4s d %x %s\n", offset, channel, id, direction, frame.Length, strings.Join(data, " "))
+	}
+	return err
+}
+
+// ascFDFlags returns the message flags of a CAN FD line: EDL, BRS and ESI.
+func ascFDFlags(frame Frame) uint32 {
+	flags := uint32(0x1000) // EDL, the frame is a CAN FD frame
+	if frame.BRS {
+		flags |= 0x2000
+	}
+	if frame.ESI {
+		flags |= 0x4000
+	}
+	return flags
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (a *ascWriter) Close() error {
+	if a.start.IsZero() {
+		a.writeHeader(time.Now())
+	}
+	fmt.Fprintf(a.w, "End TriggerBlock\n")
+	return a.w.Flush()
+}
+
+// ascReader reads Vector ASCII log files.
+type ascReader struct {
+	scanner  *bufio.Scanner
+	start    time.Time         // Time of the trigger block start, timestamps are relative to it
+	base     int               // Base of identifiers and data, 16 or 10
+	relative bool              // Timestamps are relative to the previous event
+	last     float64           // Timestamp of the previous event
+	channels map[string]string // Channel names from "// channel N: name" comments
+}
+
+func newASCReader(r io.Reader) traceReader {
+	return &ascReader{scanner: bufio.NewScanner(r), base: 16, channels: make(map[string]string)}
+}
+
+// parseASCDate parses the date of a "date" or "Begin Triggerblock" line.
+func parseASCDate(s string) (time.Time, bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	for _, layout := range ascDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ReadMessage returns the next CAN frame of the file. Header lines, events
+// and frames of other bus types are skipped.
+func (a *ascReader) ReadMessage() (CANMessage, error) {
+	for a.scanner.Scan() {
+		line := strings.TrimSpace(a.scanner.Text())
+		fields := strings.Fields(line)
+		if strings.HasPrefix(line, "//") {
+			// Channel names written by ascWriter
+			if len(fields) == 4 && fields[1] == "channel" {
+				a.channels[strings.TrimSuffix(fields[2], ":")] = fields[3]
+			}
+			continue
+		}
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "date":
+			if t, ok := parseASCDate(strings.Join(fields[1:], " ")); ok {
+				a.start = t
+			}
+			continue
+		case "base":
+			if fields[1] == "dec" {
+				a.base = 10
+			}
+			for i, f := range fields {
+				if f == "timestamps" && i+1 < len(fields) {
+					a.relative = fields[i+1] == "relative"
+				}
+			}
+			continue
+		case "begin":
+			if len(fields) > 2 {
+				if t, ok := parseASCDate(strings.Join(fields[2:], " ")); ok {
+					a.start = t
+				}
+			}
+			continue
+		}
+
+		offset, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		if a.relative {
+			offset += a.last
+		}
+		a.last = offset
+
+		msg, ok, err := a.parseEvent(fields[1:])
+		if err != nil {
+			return CANMessage{}, fmt.Errorf("%w in line '%s'", err, line)
+		}
+		if !ok {
+			continue
+		}
+		if name, ok := a.channels[msg.Channel]; ok {
+			msg.Channel = name
+		}
+		msg.Timestamp = a.start.Add(time.Duration(offset * float64(time.Second)))
+		msg.TimestampSource = TimestampReplay
+		return msg, nil
+	}
+	if err := a.scanner.Err(); err != nil {
+		return CANMessage{}, fmt.Errorf("%w: %w", errTraceRead, err)
+	}
+	return CANMessage{}, io.EOF
+}
+
+// parseEvent parses the fields of an event line following the timestamp.
+// ok is false for events that are not CAN frames.
+func (a *ascReader) parseEvent(fields []string) (msg CANMessage, ok bool, err error) {
+	if fields[0] == "CANFD" {
+		return a.parseFDEvent(fields[1:])
+	}
+	if _, err := strconv.Atoi(fields[0]); err != nil || len(fields) < 2 {
+		return msg, false, nil // Not a CAN channel, e.g. a LIN frame or a statistic
+	}
+	msg.Channel = fields[0]
+	if strings.EqualFold(fields[1], "ErrorFrame") {
+		msg.Frame = Frame{Length: CAN_ERR_DLC, IsError: true}
+		msg.Direction = "RX"
+		return msg, true, nil
+	}
+	if len(fields) < 4 {
+		return msg, false, nil
+	}
+
+	frame, err := a.parseID(fields[1])
+	if err != nil {
+		return msg, false, nil // Events like "Statistic:" or "CAN 1 Status:"
+	}
+	msg.Direction = ascDirection(fields[2])
+	switch fields[3] {
+	case "r":
+		frame.IsRemote = true
+		if len(fields) > 4 {
+			length, err := strconv.ParseUint(fields[4], 16, 8)
+			if err != nil {
+				return msg, false, fmt.Errorf("invalid DLC")
+			}
+			frame.Length = uint8(length)
+		}
+	case "d":
+		if len(fields) < 5 {
+			return msg, false, fmt.Errorf("missing DLC")
+		}
+		length, err := strconv.ParseUint(fields[4], 16, 8)
+		if err != nil || length > CAN_MAX_DLEN {
+			return msg, false, fmt.Errorf("invalid DLC")
+		}
+		frame.Length = uint8(length)
+		if err := a.parseData(&frame, fields[5:]); err != nil {
+			return msg, false, err
+		}
+	default:
+		return msg, false, nil
+	}
+	if err := frame.Validate(); err != nil {
+		return msg, false, err
+	}
+	msg.Frame = frame
+	return msg, true, nil
+}
+
+// parseFDEvent parses a CANFD event: channel, direction, identifier, an
+// optional symbolic name, BRS, ESI, DLC, data length and data.
+func (a *ascReader) parseFDEvent(fields []string) (msg CANMessage, ok bool, err error) {
+	if len(fields) < 3 {
+		return msg, false, nil
+	}
+	msg.Channel = fields[0]
+	msg.Direction = ascDirection(fields[1])
+	if strings.EqualFold(fields[2], "ErrorFrame") {
+		msg.Frame = Frame{Length: CAN_ERR_DLC, IsError: true}
+		return msg, true, nil
+	}
+
+	frame, err := a.parseID(fields[2])
+	if err != nil {
+		return msg, false, fmt.Errorf("invalid ID")
+	}
+	rest := fields[3:]
+	if len(rest) > 0 && rest[0] != "0" && rest[0] != "1" {
+		rest = rest[1:] // Symbolic name
+	}
+	if len(rest) < 4 {
+		return msg, false, fmt.Errorf("truncated CAN FD frame")
+	}
+	frame.IsFD = true
+	frame.BRS = rest[0] == "1"
+	frame.ESI = rest[1] == "1"
+	length, err := strconv.ParseUint(rest[3], 10, 8)
+	if err != nil || !isValidFDLength(uint8(length)) || length > CANFD_MAX_DLEN {
+		return msg, false, fmt.Errorf("invalid data length")
+	}
+	frame.Length = uint8(length)
+	if err := a.parseData(&frame, rest[4:]); err != nil {
+		return msg, false, err
+	}
+	msg.Frame = frame
+	return msg, true, nil
+}
+
+// parseID parses an identifier, extended identifiers end with "x".
+func (a *ascReader) parseID(s string) (Frame, error) {
+	var frame Frame
+	if strings.HasSuffix(s, "x") || strings.HasSuffix(s, "X") {
+		frame.IsExtended = true
+		s = s[:len(s)-1]
+	}
+	id, err := strconv.ParseUint(s, a.base, 32)
+	if err != nil {
+		return frame, err
+	}
+	frame.ID = uint32(id)
+	return frame, nil
+}
+
+// parseData reads frame.Length data bytes from fields.
+func (a *ascReader) parseData(frame *Frame, fields []string) error {
+	if len(fields) < int(frame.Length) {
+		return fmt.Errorf("missing data bytes")
+	}
+	for i := 0; i < int(frame.Length); i++ {
+		b, err := strconv.ParseUint(fields[i], a.base, 8)
+		if err != nil {
+			return fmt.Errorf("invalid data byte '%s'", fields[i])
+		}
+		frame.Data[i] = byte(b)
+	}
+	return nil
+}
+
+func ascDirection(s string) string {
+	if strings.EqualFold(s, "Tx") {
+		return "TX"
+	}
+	return "RX"
+}
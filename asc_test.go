@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestASCRoundTrip(t *testing.T) {
+	want := traceTestMessages()
+	// ASC error frames carry no error class
+	want[4].Frame = Frame{Length: CAN_ERR_DLC, IsError: true}
+	checkMessages(t, roundTripTrace(t, newASCWriter, newASCReader), want)
+}
+
+func TestASCMalformed(t *testing.T) {
+	trace := strings.Join([]string{
+		"date Thu Oct 16 11:05:01.250 pm 2026",
+		"base hex  timestamps absolute",
+		"Begin Triggerblock Thu Oct 16 11:05:01.250 pm 2026",
+		"   0.000000 1  123             Rx   d 2 DE AD",
+		"   0.001000 1  123             Rx   d 2 DE",
+		"   0.002000 1  123             Rx   d 2 BE EF",
+		"End TriggerBlock",
+	}, "\n")
+	expectReadError(t, newASCReader(strings.NewReader(trace)))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// BusCapabilities describes what a Bus implementation is able to do.
+type BusCapabilities struct {
+	Transmit    bool // Frames can be sent on the bus
+	FD          bool // CAN FD frames are supported
+	ErrorFrames bool // Error frames are delivered on the receive stream
+}
+
+// Bus is a CAN transport the application receives from and transmits on.
+// Implementations must be safe for concurrent use by the receive loop and
+// the send goroutines.
+type Bus interface {
+	// Name returns a short human readable name, e.g. the interface name.
+	Name() string
+	// Open connects to the underlying transport and starts receiving.
+	Open(ctx context.Context) error
+	// Receive returns the stream of received frames. The channel is closed
+	// once the bus is closed or the transport fails.
+	Receive() <-chan CANMessage
+	// Transmit puts a single frame on the bus.
+	Transmit(ctx context.Context, frame Frame) error
+	// Close releases the underlying transport.
+	Close() error
+	// Capabilities reports the features supported by the bus.
+	Capabilities() BusCapabilities
+}
+
+// newBus creates the Bus described by spec. A plain interface name such as
+// "can0" selects SocketCAN, other transports are selected by a URL scheme.
+func newBus(spec string) (Bus, error) {
+	if !strings.Contains(spec, "://") {
+		return newSocketcanBus(spec), nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bus '%s': %w", spec, err)
+	}
+
+	switch u.Scheme {
+	case "socketcan":
+		return newSocketcanBus(u.Host), nil
+	case "mem":
+		opts, err := parseMemBusOptions(u.Query())
+		if err != nil {
+			return nil, fmt.Errorf("invalid bus '%s': %w", spec, err)
+		}
+		return newMemBus(u.Host, opts), nil
+	case "slcan":
+		opts, err := parseSlcanBusOptions(u.Query())
+		if err != nil {
+			return nil, fmt.Errorf("invalid bus '%s': %w", spec, err)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid bus '%s': missing serial device", spec)
+		}
+		return newSlcanBus(u.Path, opts), nil
+	case "socketcand":
+		channel := strings.Trim(u.Path, "/")
+		if u.Host == "" || channel == "" {
+			return nil, fmt.Errorf("invalid bus '%s': expected socketcand://host[:port]/interface", spec)
+		}
+		return newSocketcandBus(u.Host, channel), nil
+	case "file":
+		opts, err := parseReplayBusOptions(u.Query())
+		if err != nil {
+			return nil, fmt.Errorf("invalid bus '%s': %w", spec, err)
+		}
+		bus, err := newReplayBus(u.Host+u.Path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bus '%s': %w", spec, err)
+		}
+		return bus, nil
+	case "cannelloni":
+		bus, err := newCannelloniBus(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bus '%s': %w", spec, err)
+		}
+		return bus, nil
+	default:
+		return nil, fmt.Errorf("unknown bus type '%s'", u.Scheme)
+	}
+}
+
+// newBuses creates the buses of a comma separated list of bus specs, e.g.
+// "can0,can1,mem://demo". Every bus must have a distinct name.
+func newBuses(specs string) ([]Bus, error) {
+	var buses []Bus
+	names := make(map[string]bool)
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		bus, err := newBus(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[bus.Name()] {
+			return nil, fmt.Errorf("bus '%s' is given more than once", bus.Name())
+		}
+		names[bus.Name()] = true
+		buses = append(buses, bus)
+	}
+	if len(buses) == 0 {
+		return nil, fmt.Errorf("no CAN interface given")
+	}
+	return buses, nil
+}
@@ -2,55 +2,154 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/google/uuid"
 	"go.einride.tech/can"
-	"go.einride.tech/can/pkg/socketcan"
-	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxConsecutiveTxFailures is the number of failed transmissions in a row
+// after which a cyclic send job is stopped.
+const maxConsecutiveTxFailures = 5
+
+// Sources of CANMessage timestamps, from most to least accurate.
+const (
+	TimestampHardware = "hardware" // Taken by the CAN controller
+	TimestampKernel   = "kernel"   // Taken by the kernel on reception
+	TimestampUser     = "user"     // Taken by the application
+	TimestampReplay   = "replay"   // Read from a replayed trace file
 )
 
 // CANMessage holds a CAN frame and its metadata.
 
 type CANMessage struct {
-	Frame     can.Frame
-	Timestamp time.Time
-	CycleTime time.Duration
-	Direction string // "RX" or "TX"
-	SentByApp bool   // True if this message was sent by the application
+	Frame           Frame
+	Channel         string // Name of the bus the frame was seen on, or its channel in a replayed trace
+	Bus             string // Name of the bus the frame was received or sent on
+	Timestamp       time.Time
+	TimestampSource string // One of the Timestamp* constants
+	CycleTime       time.Duration
+	Direction       string // "RX" or "TX"
+	SentByApp       bool   // True if this message was sent by the application
+}
+
+// msgKey identifies a message on the bus. Standard and extended frames with
+// the same numeric ID are different messages, as are frames seen on different
+// channels. Error frames are keyed by their error class bits.
+type msgKey struct {
+	Channel  string
+	ID       uint32
+	Extended bool
+	Error    bool
+}
+
+func (msg CANMessage) key() msgKey {
+	return msgKey{Channel: msg.Channel, ID: msg.Frame.ID, Extended: msg.Frame.IsExtended, Error: msg.Frame.IsError}
+}
+
+// errorIDPrefix marks the identifier column of error frames.
+const errorIDPrefix = "ERR "
+
+// formatKey renders a message key for the ID column. Error frames show their
+// error class bits after errorIDPrefix.
+func formatKey(key msgKey) string {
+	if key.Error {
+		return fmt.Sprintf("%s0x%03X", errorIDPrefix, key.ID)
+	}
+	return formatID(key.ID, key.Extended)
+}
+
+// formatID renders an identifier like candump does: three hex digits for
+// standard and eight hex digits for extended identifiers.
+func formatID(id uint32, extended bool) string {
+	if extended {
+		return fmt.Sprintf("0x%08X", id)
+	}
+	return fmt.Sprintf("0x%03X", id)
+}
+
+// parseID parses an identifier rendered by formatKey. Identifiers with more
+// than three hex digits are extended. The channel of the key is left empty.
+func parseID(s string) (msgKey, error) {
+	s = strings.TrimSpace(s)
+	if classes, ok := strings.CutPrefix(s, errorIDPrefix); ok {
+		id, err := strconv.ParseUint(strings.TrimPrefix(classes, "0x"), 16, 32)
+		if err != nil || id > CAN_ERR_MASK {
+			return msgKey{}, fmt.Errorf("invalid error class '%s'", s)
+		}
+		return msgKey{ID: uint32(id), Error: true}, nil
+	}
+	digits := strings.TrimPrefix(s, "0x")
+	id, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return msgKey{}, err
+	}
+	extended := len(digits) > 3
+	if (extended && id > can.MaxExtendedID) || (!extended && id > can.MaxID) {
+		return msgKey{}, fmt.Errorf("invalid CAN ID '%s'", s)
+	}
+	return msgKey{ID: uint32(id), Extended: extended}, nil
 }
 
 // SendMessage holds a custom CAN message to be sent.
 
 type SendMessage struct {
-	UUID      uuid.UUID
-	ID        uint32
-	DLC       uint8
-	CycleTime time.Duration
-	Data      []byte
-	Sending   bool
-	TriggerType string // "manual" or "timer"
-	ticker    *time.Ticker
-	done      chan bool
+	UUID        uuid.UUID
+	Channel     string // Bus the message is sent on, empty for the first bus
+	ID          uint32
+	Extended    bool  // True for a 29-bit identifier
+	Remote      bool  // True for a remote transmission request (RTR)
+	FD          bool  // True for a CAN FD frame
+	BRS         bool  // CAN FD bit rate switch
+	ESI         bool  // CAN FD error state indicator
+	DLC         uint8 // Number of data bytes
+	CycleTime   time.Duration
+	Data        []byte
+	Sending     bool
+	TriggerType string // "manual", "timer" or "rtr"
+	AutoReply   bool   // Send the message when a remote request for AutoReplyID is received
+	AutoReplyID uint32 // Uses the same identifier format as ID
+	Status      string // Result of the last transmission, empty if never sent
+	Errors      int    // Number of failed transmissions
+	ticker      *time.Ticker
+	stop        chan struct{} // Closed to stop the cyclic send job
+}
+
+// SendStatusMsg reports the outcome of a transmission of a send job to the UI.
+type SendStatusMsg struct {
+	UUID    uuid.UUID
+	Err     error
+	Stopped bool          // The cyclic job gave up after too many failures
+	stop    chan struct{} // Identifies the cyclic job run that reported
 }
 
+// canMsgBufferSize is the number of messages buffered between the bus
+// receivers and the UI, so bursts do not stall the receive loops.
+const canMsgBufferSize = 1024
+
 // A chan to receive CAN messages.
-var canMsgCh = make(chan CANMessage)
+var canMsgCh = make(chan CANMessage, canMsgBufferSize)
 
-func listenForCANCtrl(canInterface string) {
-	conn, err := socketcan.DialContext(context.Background(), "can", canInterface)
-	if err != nil {
-		Log(ERROR, "Failed to open CAN interface '%s': %v", canInterface, err)
-		return
-	}
-	Log(INFO, "Successfully opened CAN interface '%s'", canInterface)
-	defer conn.Close()
+// A chan to receive transmission results of send jobs.
+var sendStatusCh = make(chan SendStatusMsg, 64)
 
-	receiver := socketcan.NewReceiver(conn)
-	for {
-		if receiver.Receive() {
-			canMsgCh <- CANMessage{Frame: receiver.Frame(), Timestamp: time.Now(), Direction: "RX", SentByApp: false}
+// listenForCANCtrl forwards every frame received on the bus to canMsgCh,
+// tagged with the name of the bus. Frames of replayed traces keep the channel
+// they were recorded on.
+func listenForCANCtrl(bus Bus) {
+	_, replay := bus.(*replayBus)
+	for msg := range bus.Receive() {
+		msg.Bus = bus.Name()
+		if !replay || msg.Channel == "" {
+			msg.Channel = bus.Name()
 		}
+		canMsgCh <- msg
 	}
 }
 
@@ -58,41 +157,114 @@ func waitForCANMessage() tea.Msg {
 	return <-canMsgCh
 }
 
-func sendOnce(msg *SendMessage, canInterface string) {
-	msg.TriggerType = "manual"
-	conn, err := socketcan.DialContext(context.Background(), "can", canInterface)
-	if err != nil {
-		return
+func waitForSendStatus() tea.Msg {
+	return <-sendStatusCh
+}
+
+// txErrorText returns a short description of a transmission error, e.g.
+// "no buffer space available" for ENOBUFS.
+func txErrorText(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno.Error()
 	}
-	defer conn.Close()
+	return err.Error()
+}
 
-	tx := socketcan.NewTransmitter(conn)
-	frame := can.Frame{ID: msg.ID, Length: msg.DLC, Data: can.Data(msg.Data)}
-	_ = tx.TransmitFrame(context.Background(), frame)
-	canMsgCh <- CANMessage{Frame: frame, Timestamp: time.Now(), Direction: "TX", SentByApp: true, CycleTime: 0}
+// frame builds the CAN frame to transmit for the message.
+func (msg *SendMessage) frame() Frame {
+	frame := Frame{ID: msg.ID, Length: msg.DLC, IsExtended: msg.Extended, IsRemote: msg.Remote, IsFD: msg.FD, BRS: msg.BRS, ESI: msg.ESI}
+	if !msg.Remote {
+		copy(frame.Data[:], msg.Data)
+	}
+	return frame
 }
 
-func sendCyclic(msg *SendMessage, canInterface string) {
-	msg.TriggerType = "timer"
-	conn, err := socketcan.DialContext(context.Background(), "can", canInterface)
-	if err != nil {
+// repliesTo reports whether the message is configured as the automatic reply
+// to the given remote request.
+func (msg *SendMessage) repliesTo(request Frame) bool {
+	return msg.AutoReply && !msg.Remote && request.IsRemote &&
+		msg.AutoReplyID == request.ID && msg.Extended == request.IsExtended
+}
+
+// startCyclic starts the cyclic send job of the message on the bus.
+func (msg *SendMessage) startCyclic(bus Bus) {
+	msg.stop = make(chan struct{})
+	msg.Sending = true
+	go sendCyclic(msg, bus, msg.stop)
+}
+
+// stopCyclic stops the cyclic send job of the message if it is running.
+func (msg *SendMessage) stopCyclic() {
+	if msg.Sending {
+		close(msg.stop)
+		msg.Sending = false
+	}
+}
+
+func sendOnce(msg *SendMessage, bus Bus, trigger string) {
+	msg.TriggerType = trigger
+	frame := msg.frame()
+	if err := bus.Transmit(context.Background(), frame); err != nil {
+		Log(ERROR, "Sending %s on '%s' failed: %v", formatID(msg.ID, msg.Extended), bus.Name(), err)
+		sendStatusCh <- SendStatusMsg{UUID: msg.UUID, Err: err}
 		return
 	}
-	defer conn.Close()
+	sendStatusCh <- SendStatusMsg{UUID: msg.UUID}
+	canMsgCh <- CANMessage{Frame: frame, Channel: bus.Name(), Bus: bus.Name(), Timestamp: time.Now(), TimestampSource: TimestampUser, Direction: "TX", SentByApp: true, CycleTime: 0}
+}
 
-	tx := socketcan.NewTransmitter(conn)
-	frame := can.Frame{ID: msg.ID, Length: msg.DLC, Data: can.Data(msg.Data)}
+func sendCyclic(msg *SendMessage, bus Bus, stop chan struct{}) {
+	msg.TriggerType = "timer"
+	frame := msg.frame()
+	failures := 0
+	reported := false
 
 	msg.ticker = time.NewTicker(msg.CycleTime)
+	defer msg.ticker.Stop()
 	for {
 		select {
 		case <-msg.ticker.C:
-			_ = tx.TransmitFrame(context.Background(), frame)
-			canMsgCh <- CANMessage{Frame: frame, Timestamp: time.Now(), Direction: "TX", SentByApp: true, CycleTime: msg.CycleTime}
-		case <-msg.done:
-			msg.ticker.Stop()
+			if err := bus.Transmit(context.Background(), frame); err != nil {
+				failures++
+				// Only log the first failure of a streak to not flood the log
+				if failures == 1 {
+					Log(ERROR, "Sending %s on '%s' failed: %v", formatID(msg.ID, msg.Extended), bus.Name(), err)
+				}
+				if failures >= maxConsecutiveTxFailures {
+					Log(ERROR, "Stopped cyclic sending of %s after %d consecutive failures", formatID(msg.ID, msg.Extended), failures)
+					sendStatusCh <- SendStatusMsg{UUID: msg.UUID, Err: err, Stopped: true, stop: stop}
+					return
+				}
+				sendStatusCh <- SendStatusMsg{UUID: msg.UUID, Err: err, stop: stop}
+				continue
+			}
+			// Report the first success and every recovery from a failure streak
+			if failures > 0 || !reported {
+				sendStatusCh <- SendStatusMsg{UUID: msg.UUID, stop: stop}
+				reported = true
+			}
+			failures = 0
+			canMsgCh <- CANMessage{Frame: frame, Channel: bus.Name(), Bus: bus.Name(), Timestamp: time.Now(), TimestampSource: TimestampUser, Direction: "TX", SentByApp: true, CycleTime: msg.CycleTime}
+		case <-stop:
 			return
 		}
 	}
 }
 
+// sendMessageFromCAN creates a send message template from a message seen on
+// the bus.
+func sendMessageFromCAN(msg CANMessage) *SendMessage {
+	sendMsg := &SendMessage{
+		Channel:   msg.Channel,
+		ID:        msg.Frame.ID,
+		Extended:  msg.Frame.IsExtended,
+		Remote:    msg.Frame.IsRemote,
+		FD:        msg.Frame.IsFD,
+		BRS:       msg.Frame.BRS,
+		DLC:       msg.Frame.Length,
+		CycleTime: msg.CycleTime.Round(time.Millisecond),
+		Data:      append([]byte(nil), msg.Frame.Payload()...),
+	}
+	return sendMsg
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// candumpWriter writes messages in the log file format of candump -L -x,
+// e.g. "(1436509052.249713) can0 123#DEADBEEF R", with the direction flag
+// R for received and T for sent frames.
+type candumpWriter struct {
+	w *bufio.Writer
+}
+
+func newCandumpWriter(w io.Writer) traceWriter {
+	return &candumpWriter{w: bufio.NewWriter(w)}
+}
+
+func (c *candumpWriter) WriteMessage(msg CANMessage) error {
+	direction := "R"
+	if msg.Direction == "TX" {
+		direction = "T"
+	}
+	_, err := fmt.Fprintf(c.w, "(%d.%06d) %s %s %s\n", msg.Timestamp.Unix(), msg.Timestamp.Nanosecond()/1000, msg.Channel, msg.Frame, direction)
+	return err
+}
+
+func (c *candumpWriter) Close() error {
+	return c.w.Flush()
+}
+
+// candumpReader reads candump -L log files.
+type candumpReader struct {
+	scanner *bufio.Scanner
+}
+
+func newCandumpReader(r io.Reader) traceReader {
+	return &candumpReader{scanner: bufio.NewScanner(r)}
+}
+
+// ReadMessage returns the next frame of the log. Lines that are not frames
+// are skipped. All frames are received frames, unless the line ends with
+// the "T" direction flag of candump -L -x.
+func (c *candumpReader) ReadMessage() (CANMessage, error) {
+	for c.scanner.Scan() {
+		fields := strings.Fields(c.scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "(") || !strings.HasSuffix(fields[0], ")") {
+			continue
+		}
+		timestamp, err := parseUnixTimestamp(strings.Trim(fields[0], "()"))
+		if err != nil {
+			return CANMessage{}, fmt.Errorf("invalid timestamp '%s'", fields[0])
+		}
+		frame, err := parseCandumpFrame(fields[2])
+		if err != nil {
+			return CANMessage{}, err
+		}
+		direction := "RX"
+		if len(fields) > 3 && fields[3] == "T" {
+			direction = "TX"
+		}
+		return CANMessage{Frame: frame, Channel: fields[1], Timestamp: timestamp, TimestampSource: TimestampReplay, Direction: direction}, nil
+	}
+	if err := c.scanner.Err(); err != nil {
+		return CANMessage{}, fmt.Errorf("%w: %w", errTraceRead, err)
+	}
+	return CANMessage{}, io.EOF
+}
+
+// parseUnixTimestamp parses seconds since the epoch with an optional
+// fraction, e.g. "1436509052.249713".
+func parseUnixTimestamp(s string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(s, ".")
+	seconds, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nanos int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		if nanos, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(seconds, nanos), nil
+}
+
+// parseCandumpFrame parses a frame in the format of Frame.String, e.g.
+// "123#DEADBEEF", "12345678#R2" or "123##1DEADBEEF".
+func parseCandumpFrame(s string) (Frame, error) {
+	id, data, found := strings.Cut(s, "#")
+	if !found {
+		return Frame{}, fmt.Errorf("invalid frame '%s'", s)
+	}
+	value, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return Frame{}, fmt.Errorf("invalid ID in frame '%s'", s)
+	}
+
+	var frame Frame
+	switch {
+	case len(id) == 8 && value&CAN_ERR_FLAG != 0:
+		frame.ID = uint32(value) & CAN_ERR_MASK
+		frame.IsError = true
+	case len(id) == 8:
+		frame.ID = uint32(value)
+		frame.IsExtended = true
+	default:
+		frame.ID = uint32(value)
+	}
+
+	switch {
+	case strings.HasPrefix(data, "#"):
+		if len(data) < 2 {
+			return Frame{}, fmt.Errorf("missing CAN FD flags in frame '%s'", s)
+		}
+		flags, err := strconv.ParseUint(data[1:2], 16, 8)
+		if err != nil {
+			return Frame{}, fmt.Errorf("invalid CAN FD flags in frame '%s'", s)
+		}
+		frame.IsFD = true
+		frame.BRS = flags&CANFD_BRS != 0
+		frame.ESI = flags&CANFD_ESI != 0
+		data = data[2:]
+	case strings.HasPrefix(data, "R"):
+		frame.IsRemote = true
+		if len(data) > 1 {
+			length, err := strconv.ParseUint(data[1:], 10, 8)
+			if err != nil || length > CAN_MAX_DLEN {
+				return Frame{}, fmt.Errorf("invalid remote length in frame '%s'", s)
+			}
+			frame.Length = uint8(length)
+		}
+		return frame, frame.Validate()
+	}
+
+	data = strings.ReplaceAll(data, ".", "") // Optional byte separators
+	payload, err := hex.DecodeString(data)
+	if err != nil || len(payload) > CANFD_MAX_DLEN {
+		return Frame{}, fmt.Errorf("invalid data in frame '%s'", s)
+	}
+	frame.Length = uint8(len(payload))
+	copy(frame.Data[:], payload)
+	if frame.IsError {
+		return frame, nil
+	}
+	return frame, frame.Validate()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCandumpRoundTrip(t *testing.T) {
+	checkMessages(t, roundTripTrace(t, newCandumpWriter, newCandumpReader), traceTestMessages())
+}
+
+func TestCandumpDirection(t *testing.T) {
+	frame := Frame{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}
+	trace := writeTrace(t, newCandumpWriter, []CANMessage{
+		{Frame: frame, Channel: "can0", Timestamp: time.Unix(1436509052, 249713000), Direction: "RX"},
+		{Frame: frame, Channel: "can1", Timestamp: time.Unix(1436509053, 0), Direction: "TX"},
+	})
+	want := "(1436509052.249713) can0 123#DEAD R\n(1436509053.000000) can1 123#DEAD T\n"
+	if string(trace) != want {
+		t.Errorf("got %q, want %q", trace, want)
+	}
+}
+
+func TestCandumpReader(t *testing.T) {
+	trace := strings.Join([]string{
+		"(1436509052.249713) can0 123#DEADBEEF",
+		"(1436509052.25) can1 12345678#R2 T",
+		"(1436509053.000000) vcan0 321##1AA R",
+		"",
+		"not a frame",
+		"(1436509053.5) can0 20000040#0000000000000000",
+	}, "\n")
+	tests := []struct {
+		frame     Frame
+		channel   string
+		timestamp time.Time
+		direction string
+	}{
+		{Frame{ID: 0x123, Length: 4, Data: [64]byte{0xDE, 0xAD, 0xBE, 0xEF}}, "can0", time.Unix(1436509052, 249713000), "RX"},
+		{Frame{ID: 0x12345678, Length: 2, IsExtended: true, IsRemote: true}, "can1", time.Unix(1436509052, 250000000), "TX"},
+		{Frame{ID: 0x321, Length: 1, Data: [64]byte{0xAA}, IsFD: true, BRS: true}, "vcan0", time.Unix(1436509053, 0), "RX"},
+		{Frame{ID: CAN_ERR_BUSOFF, Length: CAN_ERR_DLC, IsError: true}, "can0", time.Unix(1436509053, 500000000), "RX"},
+	}
+	got := readAllMessages(t, newCandumpReader(strings.NewReader(trace)))
+	if len(got) != len(tests) {
+		t.Fatalf("got %d messages, want %d", len(got), len(tests))
+	}
+	for i, tt := range tests {
+		msg := got[i]
+		if msg.Frame != tt.frame || msg.Channel != tt.channel || !msg.Timestamp.Equal(tt.timestamp) || msg.Direction != tt.direction {
+			t.Errorf("message %d: got %v on %s at %v %s, want %v on %s at %v %s", i,
+				msg.Frame, msg.Channel, msg.Timestamp, msg.Direction, tt.frame, tt.channel, tt.timestamp, tt.direction)
+		}
+	}
+}
+
+func TestCandumpMalformed(t *testing.T) {
+	trace := "(1.000000) can0 123#01\n(2.000000) can0 123#0\n(3.000000) can0 123#02\n"
+	expectReadError(t, newCandumpReader(strings.NewReader(trace)))
+	for _, line := range []string{
+		"(x.000000) can0 123#01", // Invalid timestamp
+		"(1.000000) can0 123",    // No separator
+		"(1.000000) can0 12X#01", // Invalid ID
+		"(1.000000) can0 123#R9", // Classic remote frames are at most 8 bytes
+		"(1.000000) can0 123##",  // Missing CAN FD flags
+	} {
+		if msg, err := newCandumpReader(strings.NewReader(line)).ReadMessage(); err == nil {
+			t.Errorf("read %q as %v, want an error", line, msg.Frame)
+		}
+	}
+}
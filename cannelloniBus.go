@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Cannelloni packet layout as defined by the cannelloni reference
+// implementation.
+const (
+	cannelloniVersion    = 2
+	cannelloniOpData     = 0
+	cannelloniHeaderSize = 5    // version, op code, sequence number, frame count
+	cannelloniFDFlag     = 0x80 // Set in the length byte of CAN FD frames
+)
+
+// cannelloniMaxPacketSize keeps packets below the Ethernet MTU, so they are
+// not fragmented.
+const cannelloniMaxPacketSize = 1472
+
+// cannelloniDefaultBatch is how long outbound frames are collected before
+// they are sent in one packet.
+const cannelloniDefaultBatch = time.Millisecond
+
+// cannelloniBus is a Bus tunneled over UDP with the cannelloni protocol.
+//
+// In client mode frames are sent to a fixed remote address. In server mode
+// the bus listens on a local port and talks to the peer the last packet was
+// received from.
+type cannelloniBus struct {
+	remote *net.UDPAddr // Fixed peer in client mode, nil in server mode
+	local  string       // Local address to listen on
+	batch  time.Duration
+	conn   *net.UDPConn
+	peer   atomic.Pointer[net.UDPAddr]
+	rx     chan CANMessage
+
+	txMutex sync.Mutex // Guards the pending packet
+	pending []Frame
+	size    int // Encoded size of the pending packet
+	timer   *time.Timer
+	seqNo   uint8
+	closing atomic.Bool
+}
+
+// newCannelloniBus creates a cannelloni bus from a cannelloni:// URL. A URL
+// with a host, e.g. cannelloni://10.0.0.5:20000?listen=:20000, selects client
+// mode, a URL with only a port, e.g. cannelloni://:20000, server mode.
+func newCannelloniBus(u *url.URL) (*cannelloniBus, error) {
+	b := &cannelloniBus{
+		batch: cannelloniDefaultBatch,
+		rx:    make(chan CANMessage),
+	}
+	query := u.Query()
+	if v := query.Get("batch"); v != "" {
+		batch, err := time.ParseDuration(v)
+		if err != nil || batch < 0 {
+			return nil, fmt.Errorf("invalid batch timeout '%s'", v)
+		}
+		b.batch = batch
+	}
+
+	if u.Hostname() == "" {
+		if u.Port() == "" {
+			return nil, errors.New("server mode needs a port to listen on")
+		}
+		b.local = u.Host
+		return b, nil
+	}
+	remote, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	b.remote = remote
+	b.local = query.Get("listen")
+	return b, nil
+}
+
+func (b *cannelloniBus) Name() string {
+	if b.remote != nil {
+		return "cannelloni://" + b.remote.String()
+	}
+	return "cannelloni://" + b.local
+}
+
+func (b *cannelloniBus) Open(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var local *net.UDPAddr
+	if b.local != "" {
+		addr, err := net.ResolveUDPAddr("udp", b.local)
+		if err != nil {
+			return err
+		}
+		local = addr
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	if b.remote != nil {
+		b.peer.Store(b.remote)
+	}
+
+	go b.receive()
+	return nil
+}
+
+// receive forwards the frames of received packets to the receive channel
+// until the connection is closed.
+func (b *cannelloniBus) receive() {
+	defer close(b.rx)
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !b.closing.Load() {
+				Log(ERROR, "Receiving from '%s' failed: %v", b.Name(), err)
+			}
+			return
+		}
+		if b.remote == nil {
+			b.peer.Store(addr)
+		}
+
+		timestamp := time.Now()
+		frames, err := decodeCannelloniPacket(buf[:n])
+		if err != nil {
+			Log(WARNING, "Ignoring malformed cannelloni packet from %s: %v", addr, err)
+		}
+		for _, frame := range frames {
+			b.rx <- CANMessage{Frame: frame, Timestamp: timestamp, TimestampSource: TimestampUser, Direction: "RX", SentByApp: false}
+		}
+	}
+}
+
+func (b *cannelloniBus) Receive() <-chan CANMessage {
+	return b.rx
+}
+
+// Transmit queues the frame for the next packet. The packet is sent once the
+// batch timeout elapses or no further frame fits into it.
+func (b *cannelloniBus) Transmit(ctx context.Context, frame Frame) error {
+	if b.conn == nil {
+		return fmt.Errorf("bus '%s' is not open", b.Name())
+	}
+	if err := frame.Validate(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if b.peer.Load() == nil {
+		return fmt.Errorf("no peer has connected to '%s' yet", b.Name())
+	}
+
+	b.txMutex.Lock()
+	defer b.txMutex.Unlock()
+	size := cannelloniFrameSize(frame)
+	if b.size+size > cannelloniMaxPacketSize {
+		if err := b.flushLocked(); err != nil {
+			return err
+		}
+	}
+	if b.size == 0 {
+		b.size = cannelloniHeaderSize
+	}
+	b.pending = append(b.pending, frame)
+	b.size += size
+
+	if b.batch == 0 {
+		return b.flushLocked()
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.batch, b.flush)
+	}
+	return nil
+}
+
+// flush sends the pending packet when the batch timeout elapses.
+func (b *cannelloniBus) flush() {
+	b.txMutex.Lock()
+	defer b.txMutex.Unlock()
+	if err := b.flushLocked(); err != nil && !b.closing.Load() {
+		Log(ERROR, "Sending to '%s' failed: %v", b.Name(), err)
+	}
+}
+
+// flushLocked sends the pending frames in one packet. txMutex must be held.
+func (b *cannelloniBus) flushLocked() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return nil
+	}
+	packet := encodeCannelloniPacket(b.seqNo, b.pending)
+	b.seqNo++
+	b.pending = b.pending[:0]
+	b.size = 0
+	_, err := b.conn.WriteToUDP(packet, b.peer.Load())
+	return err
+}
+
+func (b *cannelloniBus) Close() error {
+	if b.conn == nil {
+		return nil
+	}
+	b.txMutex.Lock()
+	b.flushLocked()
+	b.txMutex.Unlock()
+	b.closing.Store(true)
+	return b.conn.Close()
+}
+
+func (b *cannelloniBus) Capabilities() BusCapabilities {
+	return BusCapabilities{Transmit: true, FD: true, ErrorFrames: true}
+}
+
+// cannelloniFrameSize returns the number of bytes a frame occupies in a
+// packet.
+func cannelloniFrameSize(frame Frame) int {
+	size := 5 // Identifier and length
+	if frame.IsFD {
+		size++ // Flags
+	}
+	return size + len(frame.Payload())
+}
+
+// encodeCannelloniPacket encodes frames as cannelloni data packet.
+func encodeCannelloniPacket(seqNo uint8, frames []Frame) []byte {
+	packet := []byte{cannelloniVersion, cannelloniOpData, seqNo, 0, 0}
+	binary.BigEndian.PutUint16(packet[3:5], uint16(len(frames)))
+	for _, frame := range frames {
+		idAndFlags := frame.ID
+		if frame.IsExtended {
+			idAndFlags |= unix.CAN_EFF_FLAG
+		}
+		if frame.IsRemote {
+			idAndFlags |= unix.CAN_RTR_FLAG
+		}
+		if frame.IsError {
+			idAndFlags |= CAN_ERR_FLAG
+		}
+		packet = binary.BigEndian.AppendUint32(packet, idAndFlags)
+		if frame.IsFD {
+			var flags uint8
+			if frame.BRS {
+				flags |= CANFD_BRS
+			}
+			if frame.ESI {
+				flags |= CANFD_ESI
+			}
+			packet = append(packet, frame.Length|cannelloniFDFlag, flags)
+		} else {
+			packet = append(packet, frame.Length)
+		}
+		packet = append(packet, frame.Payload()...)
+	}
+	return packet
+}
+
+// decodeCannelloniPacket decodes the frames of a cannelloni data packet. The
+// frames decoded before an error are returned with it.
+func decodeCannelloniPacket(packet []byte) ([]Frame, error) {
+	if len(packet) < cannelloniHeaderSize {
+		return nil, errors.New("packet too short")
+	}
+	if packet[0] != cannelloniVersion {
+		return nil, fmt.Errorf("unsupported version %d", packet[0])
+	}
+	if packet[1] != cannelloniOpData {
+		return nil, nil // Only data packets carry frames
+	}
+	count := int(binary.BigEndian.Uint16(packet[3:5]))
+
+	var frames []Frame
+	data := packet[cannelloniHeaderSize:]
+	for i := 0; i < count; i++ {
+		if len(data) < 5 {
+			return frames, errors.New("truncated frame")
+		}
+		idAndFlags := binary.BigEndian.Uint32(data[0:4])
+		length := data[4]
+		data = data[5:]
+
+		var frame Frame
+		switch {
+		case idAndFlags&CAN_ERR_FLAG != 0:
+			frame = Frame{ID: idAndFlags & CAN_ERR_MASK, IsError: true}
+		case idAndFlags&unix.CAN_EFF_FLAG != 0:
+			frame = Frame{ID: idAndFlags & unix.CAN_EFF_MASK, IsExtended: true}
+		default:
+			frame = Frame{ID: idAndFlags & unix.CAN_SFF_MASK}
+		}
+		frame.IsRemote = idAndFlags&unix.CAN_RTR_FLAG != 0 && !frame.IsError
+
+		if length&cannelloniFDFlag != 0 {
+			if len(data) < 1 {
+				return frames, errors.New("truncated frame")
+			}
+			frame.IsFD = true
+			frame.BRS = data[0]&CANFD_BRS != 0
+			frame.ESI = data[0]&CANFD_ESI != 0
+			data = data[1:]
+			length &^= cannelloniFDFlag
+		}
+		frame.Length = length
+		if int(length) > len(frame.Data) || (!frame.IsFD && length > CAN_MAX_DLEN) {
+			return frames, fmt.Errorf("invalid length %d", length)
+		}
+
+		if !frame.IsRemote {
+			if len(data) < int(length) {
+				return frames, errors.New("truncated frame")
+			}
+			copy(frame.Data[:], data[:length])
+			data = data[length:]
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
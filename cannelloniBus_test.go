@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestCannelloniPacketRoundTrip(t *testing.T) {
+	fd := Frame{ID: 0x18DAF110, Length: 64, IsExtended: true, IsFD: true, BRS: true, ESI: true}
+	for i := range fd.Length {
+		fd.Data[i] = i
+	}
+	ackError := Frame{ID: CAN_ERR_ACK | CAN_ERR_PROT, Length: CAN_ERR_DLC, IsError: true}
+	ackError.Data[3] = 0x19
+	tests := []struct {
+		name   string
+		frames []Frame
+	}{
+		{"classic", []Frame{{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}}},
+		{"extended", []Frame{{ID: 0x18FEF100, Length: 8, Data: [64]byte{1, 2, 3, 4, 5, 6, 7, 8}, IsExtended: true}}},
+		{"fd", []Frame{fd}},
+		{"fd without flags", []Frame{{ID: 0x7FF, Length: 12, IsFD: true}}},
+		{"remote", []Frame{{ID: 0x321, Length: 4, IsRemote: true}}},
+		{"error", []Frame{ackError}},
+		{"batch", []Frame{{ID: 0x1}, fd, {ID: 0x2, Length: 1, Data: [64]byte{0xFF}}, {ID: 0x1234567, IsExtended: true, IsRemote: true}}},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := encodeCannelloniPacket(42, tt.frames)
+			if packet[0] != cannelloniVersion || packet[1] != cannelloniOpData || packet[2] != 42 {
+				t.Errorf("header = % X", packet[:cannelloniHeaderSize])
+			}
+			size := cannelloniHeaderSize
+			for _, frame := range tt.frames {
+				size += cannelloniFrameSize(frame)
+			}
+			if len(packet) != size {
+				t.Errorf("packet has %d bytes, want %d", len(packet), size)
+			}
+			frames, err := decodeCannelloniPacket(packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != len(tt.frames) {
+				t.Fatalf("got %v, want %v", frames, tt.frames)
+			}
+			for i := range frames {
+				if frames[i] != tt.frames[i] {
+					t.Errorf("frame %d: got %+v, want %+v", i, frames[i], tt.frames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCannelloniFDLengthFlag(t *testing.T) {
+	packet := encodeCannelloniPacket(0, []Frame{{ID: 0x123, Length: 12, IsFD: true, BRS: true}})
+	frame := packet[cannelloniHeaderSize:]
+	if frame[4] != 12|cannelloniFDFlag || frame[5] != CANFD_BRS {
+		t.Errorf("length and flags = %02X %02X, want %02X %02X", frame[4], frame[5], 12|cannelloniFDFlag, CANFD_BRS)
+	}
+}
+
+func TestCannelloniPacketMalformed(t *testing.T) {
+	valid := encodeCannelloniPacket(0, []Frame{
+		{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}},
+		{ID: 0x456, Length: 12, IsFD: true},
+	})
+	tests := []struct {
+		name   string
+		packet []byte
+		frames int // Frames decoded before the error
+	}{
+		{"empty", nil, 0},
+		{"truncated header", valid[:cannelloniHeaderSize-1], 0},
+		{"wrong version", append([]byte{1}, valid[1:]...), 0},
+		{"truncated identifier", valid[:cannelloniHeaderSize+3], 0},
+		{"truncated data", valid[:cannelloniHeaderSize+6], 0},
+		{"truncated fd flags", valid[:cannelloniHeaderSize+7+5], 1},
+		{"truncated second frame", valid[:len(valid)-1], 1},
+		{"more frames than sent", append([]byte{cannelloniVersion, cannelloniOpData, 0, 0, 3}, valid[cannelloniHeaderSize:]...), 2},
+		{"classic length over 8", []byte{cannelloniVersion, cannelloniOpData, 0, 0, 1, 0, 0, 1, 0x23, 9}, 0},
+		{"fd length over 64", []byte{cannelloniVersion, cannelloniOpData, 0, 0, 1, 0, 0, 1, 0x23, 65 | cannelloniFDFlag, 0}, 0},
+	}
+	for _, tt := range tests {
+		frames, err := decodeCannelloniPacket(tt.packet)
+		if err == nil {
+			t.Errorf("%s: decoded %v, want an error", tt.name, frames)
+		}
+		if len(frames) != tt.frames {
+			t.Errorf("%s: got %d frames before the error, want %d", tt.name, len(frames), tt.frames)
+		}
+	}
+}
+
+func TestCannelloniBusLoopback(t *testing.T) {
+	server, err := newBus("cannelloni://:0?batch=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	port := server.(*cannelloniBus).conn.LocalAddr().(*net.UDPAddr).Port
+
+	// The client collects frames for a few milliseconds and sends them in one packet
+	client, err := newBus(fmt.Sprintf("cannelloni://127.0.0.1:%d?listen=127.0.0.1:0&batch=5ms", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := server.Transmit(context.Background(), Frame{ID: 0x1}); err == nil {
+		t.Error("server sent a frame before a peer connected")
+	}
+
+	frames := []Frame{
+		{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}},
+		{ID: 0x18DAF110, Length: 16, IsExtended: true, IsFD: true, BRS: true},
+		{ID: 0x321, Length: 4, IsRemote: true},
+	}
+	for _, frame := range frames {
+		if err := client.Transmit(context.Background(), frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range frames {
+		if msg := nextMessage(t, server.Receive()); msg.Frame != want || msg.Direction != "RX" {
+			t.Errorf("server received %v %s, want %v RX", msg.Frame, msg.Direction, want)
+		}
+	}
+
+	// The server answers the peer it last heard from
+	reply := Frame{ID: 0x7FF, Length: 1, Data: [64]byte{0x42}}
+	if err := server.Transmit(context.Background(), reply); err != nil {
+		t.Fatal(err)
+	}
+	if msg := nextMessage(t, client.Receive()); msg.Frame != reply {
+		t.Errorf("client received %v, want %v", msg.Frame, reply)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCSVColumns are the columns of CSV exports unless configured with
+// the -csv flag.
+const defaultCSVColumns = "time,reltime,channel,dir,id,ext,dlc,data"
+
+// csvColumnNames lists the available CSV columns.
+var csvColumnNames = []string{"time", "reltime", "channel", "dir", "id", "ext", "dlc", "type", "data", "signals"}
+
+// csvColumns are the columns written by csvWriter, set from the -csv flag.
+var csvColumns = strings.Split(defaultCSVColumns, ",")
+
+// parseCSVColumns parses a comma separated list of CSV columns.
+func parseCSVColumns(s string) ([]string, error) {
+	var columns []string
+	for _, column := range strings.Split(s, ",") {
+		column = strings.TrimSpace(column)
+		known := false
+		for _, name := range csvColumnNames {
+			known = known || name == column
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown CSV column '%s', available columns: %s", column, strings.Join(csvColumnNames, ","))
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// csvValue renders a column of a message. Relative times are seconds since
+// start.
+func csvValue(column string, msg CANMessage, start time.Time) string {
+	frame := msg.Frame
+	switch column {
+	case "time":
+		return msg.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00")
+	case "reltime":
+		return strconv.FormatFloat(msg.Timestamp.Sub(start).Seconds(), 'f', 6, 64)
+	case "channel":
+		return msg.Channel
+	case "dir":
+		return msg.Direction
+	case "id":
+		return formatKey(msg.key())
+	case "ext":
+		if frame.IsExtended {
+			return "1"
+		}
+		return "0"
+	case "dlc":
+		return strconv.Itoa(int(frame.Length))
+	case "type":
+		return frame.TypeString()
+	case "data":
+		payload := frame.Payload()
+		data := make([]string, len(payload))
+		for i, b := range payload {
+			data[i] = fmt.Sprintf("%02X", b)
+		}
+		return strings.Join(data, " ")
+	case "signals":
+		dbcMsg := signalDB.message(frame)
+		if dbcMsg == nil {
+			return ""
+		}
+		values := dbcMsg.decode(frame.Payload())
+		signals := make([]string, len(values))
+		for i, v := range values {
+			signals[i] = v.String()
+		}
+		return strings.Join(signals, "; ")
+	}
+	return ""
+}
+
+// csvWriter writes messages as CSV with a header row and the configured
+// columns.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	start   time.Time // Base of relative times, the first message if zero
+	started bool
+}
+
+func newCSVWriter(w io.Writer) traceWriter {
+	return &csvWriter{w: csv.NewWriter(w), columns: csvColumns}
+}
+
+func (c *csvWriter) WriteMessage(msg CANMessage) error {
+	if !c.started {
+		c.started = true
+		if c.start.IsZero() {
+			c.start = msg.Timestamp
+		}
+		if err := c.w.Write(c.columns); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		record[i] = csvValue(column, msg, c.start)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	if !c.started {
+		c.started = true
+		c.w.Write(c.columns)
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// exportCSV writes messages to a new CSV file. Relative times start at the
+// earliest message.
+func exportCSV(fileName string, messages []CANMessage) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	writer := newCSVWriter(file).(*csvWriter)
+	for _, msg := range messages {
+		if writer.start.IsZero() || msg.Timestamp.Before(writer.start) {
+			writer.start = msg.Timestamp
+		}
+	}
+	for _, msg := range messages {
+		if err := writer.WriteMessage(msg); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
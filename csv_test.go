@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useCSVColumns sets the columns of CSV exports for the rest of the test.
+func useCSVColumns(t *testing.T, columns []string) {
+	t.Helper()
+	saved := csvColumns
+	csvColumns = columns
+	t.Cleanup(func() { csvColumns = saved })
+}
+
+// readCSV parses a CSV file into its header and rows.
+func readCSV(t *testing.T, data []byte) (header []string, rows [][]string) {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v\n%s", err, data)
+	}
+	if len(records) == 0 {
+		t.Fatal("no header row")
+	}
+	return records[0], records[1:]
+}
+
+func TestParseCSVColumns(t *testing.T) {
+	tests := []struct {
+		value   string
+		columns []string
+		ok      bool
+	}{
+		{defaultCSVColumns, []string{"time", "reltime", "channel", "dir", "id", "ext", "dlc", "data"}, true},
+		{"id,signals", []string{"id", "signals"}, true},
+		{" reltime , type ", []string{"reltime", "type"}, true},
+		{"data,id,data", []string{"data", "id", "data"}, true},
+		{strings.Join(csvColumnNames, ","), csvColumnNames, true},
+		{"id,speed", nil, false},
+		{"ID", nil, false},
+		{"id,,data", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		columns, err := parseCSVColumns(tt.value)
+		if (err == nil) != tt.ok || !slices.Equal(columns, tt.columns) {
+			t.Errorf("parse %q = %v, %v, want %v", tt.value, columns, err, tt.columns)
+		}
+	}
+	if _, err := parseCSVColumns("id,speed"); err == nil || !strings.Contains(err.Error(), "'speed'") {
+		t.Errorf("error %v does not name the unknown column", err)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	useTestDBC(t, testDBC)
+	useCSVColumns(t, csvColumnNames)
+	start := time.Date(2026, 10, 16, 23, 5, 1, 250_000_000, time.UTC)
+	engine := Frame{ID: 0x123, Length: 8}
+	copy(engine.Data[:], testDBCData)
+	messages := []CANMessage{
+		{Frame: engine, Channel: "can0", Timestamp: start, Direction: "RX"},
+		{Frame: Frame{ID: 0x18FEF100, Length: 2, Data: [64]byte{0xDE, 0xAD}, IsExtended: true}, Channel: "mem://a,b", Timestamp: start.Add(1500 * time.Microsecond), Direction: "TX"},
+		{Frame: Frame{ID: 0x7FF, Length: 4, IsRemote: true}, Channel: "can0", Timestamp: start.Add(time.Second), Direction: "RX"},
+		{Frame: Frame{ID: CAN_ERR_BUSOFF, Length: CAN_ERR_DLC, IsError: true}, Channel: "can0", Timestamp: start.Add(2 * time.Second), Direction: "RX"},
+	}
+
+	trace := writeTrace(t, newCSVWriter, messages)
+	header, rows := readCSV(t, trace)
+	if !slices.Equal(header, csvColumnNames) {
+		t.Errorf("header = %v, want %v", header, csvColumnNames)
+	}
+	want := [][]string{
+		{"2026-10-16T23:05:01.250000Z", "0.000000", "can0", "RX", "0x123", "0", "8", "CAN", "C0 AB EC F3 80 03 80 09",
+			"Speed=1374.0 km/h; Temp=-20 degC; Torque=-50.00 Nm; Gear=3 (Drive, sport); Delta=-128; Counter=9"},
+		{"2026-10-16T23:05:01.251500Z", "0.001500", "mem://a,b", "TX", "0x18FEF100", "1", "2", "CAN", "DE AD", ""},
+		{"2026-10-16T23:05:02.250000Z", "1.000000", "can0", "RX", "0x7FF", "0", "4", "RTR", "", ""},
+		{"2026-10-16T23:05:03.250000Z", "2.000000", "can0", "RX", formatKey(messages[3].key()), "0", "8", "ERR", "00 00 00 00 00 00 00 00", ""},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(rows[i], want[i]) {
+			t.Errorf("row %d:\ngot  %q\nwant %q", i, rows[i], want[i])
+		}
+	}
+
+	// Fields with commas are quoted, space separated data bytes are not
+	for _, field := range []string{`"mem://a,b"`, `"Speed=1374.0 km/h;`, `,DE AD,`} {
+		if !bytes.Contains(trace, []byte(field)) {
+			t.Errorf("file does not contain %s:\n%s", field, trace)
+		}
+	}
+}
+
+func TestCSVWriterColumns(t *testing.T) {
+	useCSVColumns(t, []string{"dlc", "id", "reltime"})
+	start := time.Date(2026, 10, 16, 23, 5, 1, 0, time.UTC)
+	trace := writeTrace(t, newCSVWriter, []CANMessage{
+		{Frame: Frame{ID: 0x1, Length: 1}, Timestamp: start.Add(time.Second)},
+		{Frame: Frame{ID: 0x2, Length: 2}, Timestamp: start},
+	})
+	// Relative times start at the first message written
+	if want := "dlc,id,reltime\n1,0x001,0.000000\n2,0x002,-1.000000\n"; string(trace) != want {
+		t.Errorf("got %q, want %q", trace, want)
+	}
+
+	// An empty recording still has the header
+	if trace := writeTrace(t, newCSVWriter, nil); string(trace) != "dlc,id,reltime\n" {
+		t.Errorf("empty recording = %q", trace)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	useCSVColumns(t, []string{"id", "time", "reltime"})
+	start := time.Date(2026, 10, 16, 23, 5, 1, 0, time.UTC)
+	// Receive table order, not sorted by time
+	messages := []CANMessage{
+		{Frame: Frame{ID: 0x300}, Timestamp: start.Add(2 * time.Second)},
+		{Frame: Frame{ID: 0x100}, Timestamp: start.Add(500 * time.Millisecond)},
+		{Frame: Frame{ID: 0x200}, Timestamp: start.Add(1250 * time.Millisecond)},
+	}
+	path := filepath.Join(t.TempDir(), "export.csv")
+	if err := exportCSV(path, messages); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Relative times start at the earliest message
+	_, rows := readCSV(t, data)
+	want := [][]string{
+		{"0x300", "2026-10-16T23:05:03.000000Z", "1.500000"},
+		{"0x100", "2026-10-16T23:05:01.500000Z", "0.000000"},
+		{"0x200", "2026-10-16T23:05:02.250000Z", "0.750000"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(rows[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+
+	if err := exportCSV(filepath.Join(t.TempDir(), "missing", "export.csv"), messages); err == nil {
+		t.Error("export to a missing directory succeeded")
+	}
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// signalDB holds the messages of the DBC files given with -dbc, nil if none
+// were loaded.
+var signalDB *dbcDatabase
+
+// dbcKey identifies a message of a DBC database. Unlike msgKey it does not
+// depend on the channel.
+type dbcKey struct {
+	ID       uint32
+	Extended bool
+}
+
+// dbcDatabase holds the messages of one or more DBC files.
+type dbcDatabase struct {
+	messages map[dbcKey]*dbcMessage
+}
+
+// dbcMessage is a message defined in a DBC file.
+type dbcMessage struct {
+	ID          uint32
+	Extended    bool
+	Name        string
+	Size        int // Payload length in bytes
+	Transmitter string
+	Signals     []*dbcSignal
+}
+
+// dbcSignal is a signal of a DBC message.
+type dbcSignal struct {
+	Name      string
+	StartBit  int
+	Size      int
+	BigEndian bool // Motorola byte order, StartBit is the most significant bit
+	Signed    bool
+	FloatSize int // 32 or 64 for IEEE float signals, 0 for integers
+	Factor    float64
+	Offset    float64
+	Min       float64
+	Max       float64
+	Unit      string
+	Values    map[int64]string // Value table, raw value to description
+
+	MuxSwitch   bool       // Multiplexer switch, selects the signals sent with the message
+	Multiplexer *dbcSignal // Switch the signal is multiplexed by, nil if it is always sent
+	MuxRanges   []muxRange // Values of Multiplexer the signal is sent with
+}
+
+// muxRange is a range of multiplexer switch values, From and To included.
+type muxRange struct {
+	From, To uint64
+}
+
+// loadDBC parses and merges DBC files. Messages defined in several files are
+// taken from the last one.
+func loadDBC(paths []string) (*dbcDatabase, error) {
+	db := &dbcDatabase{messages: make(map[dbcKey]*dbcMessage)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.parse(path, data); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// extendedMuxPattern matches signals that are multiplexed and a multiplexer
+// switch themselves ("m3M"), which the DBC parser does not support.
+var extendedMuxPattern = regexp.MustCompile(`^(\s*SG_\s+(\w+)\s+m\d+)M(\s*:)`)
+
+// messagePattern matches message definitions.
+var messagePattern = regexp.MustCompile(`^\s*BO_\s+(\d+)\s`)
+
+// muxValuesPattern matches the extended multiplexing definitions
+// "SG_MUL_VAL_ <message> <signal> <switch> <from>-<to>, ...;".
+var muxValuesPattern = regexp.MustCompile(`SG_MUL_VAL_\s+(\d+)\s+(\w+)\s+(\w+)\s+([^;]*);`)
+
+// muxRangePattern matches a range of SG_MUL_VAL_.
+var muxRangePattern = regexp.MustCompile(`(\d+)\s*-\s*(\d+)`)
+
+// preprocess rewrites signals that are multiplexed multiplexer switches to
+// plain multiplexed signals, so the DBC parser accepts them. It returns the
+// rewritten file and the switches by message and name.
+func preprocess(data []byte) ([]byte, map[dbc.MessageID]map[string]bool) {
+	switches := make(map[dbc.MessageID]map[string]bool)
+	var message dbc.MessageID
+	lines := strings.SplitAfter(string(data), "\n")
+	for i, line := range lines {
+		if match := messagePattern.FindStringSubmatch(line); match != nil {
+			id, _ := strconv.ParseUint(match[1], 10, 32)
+			message = dbc.MessageID(id)
+		}
+		if match := extendedMuxPattern.FindStringSubmatch(line); match != nil {
+			if switches[message] == nil {
+				switches[message] = make(map[string]bool)
+			}
+			switches[message][match[2]] = true
+			lines[i] = extendedMuxPattern.ReplaceAllString(line, "$1$3")
+		}
+	}
+	return []byte(strings.Join(lines, "")), switches
+}
+
+// parse adds the messages of a DBC file to the database.
+func (db *dbcDatabase) parse(path string, data []byte) error {
+	data, switches := preprocess(data)
+	parser := dbc.NewParser(path, data)
+	if err := parser.Parse(); err != nil {
+		return err
+	}
+
+	signals := make(map[dbcKey]map[string]*dbcSignal)
+	var messages []*dbcMessage
+	for _, def := range parser.Defs() {
+		msgDef, ok := def.(*dbc.MessageDef)
+		if !ok || msgDef.Name == "VECTOR__INDEPENDENT_SIG_MSG" {
+			continue
+		}
+		msg := &dbcMessage{
+			ID:          uint32(msgDef.MessageID.ToCAN()),
+			Extended:    msgDef.MessageID.IsExtended(),
+			Name:        string(msgDef.Name),
+			Size:        int(msgDef.Size),
+			Transmitter: string(msgDef.Transmitter),
+		}
+		if msg.Transmitter == "Vector__XXX" {
+			msg.Transmitter = ""
+		}
+		key := dbcKey{ID: msg.ID, Extended: msg.Extended}
+		signals[key] = make(map[string]*dbcSignal)
+		var muxSwitch *dbcSignal // The switch of simple multiplexing, "M"
+		var multiplexed []*dbcSignal
+		for _, sigDef := range msgDef.Signals {
+			sig := &dbcSignal{
+				Name:      string(sigDef.Name),
+				StartBit:  int(sigDef.StartBit),
+				Size:      int(sigDef.Size),
+				BigEndian: sigDef.IsBigEndian,
+				Signed:    sigDef.IsSigned,
+				Factor:    sigDef.Factor,
+				Offset:    sigDef.Offset,
+				Min:       sigDef.Minimum,
+				Max:       sigDef.Maximum,
+				Unit:      sigDef.Unit,
+				MuxSwitch: sigDef.IsMultiplexerSwitch || switches[msgDef.MessageID][string(sigDef.Name)],
+			}
+			if sigDef.IsMultiplexerSwitch {
+				muxSwitch = sig
+			}
+			if sigDef.IsMultiplexed {
+				sig.MuxRanges = []muxRange{{From: sigDef.MultiplexerSwitch, To: sigDef.MultiplexerSwitch}}
+				multiplexed = append(multiplexed, sig)
+			}
+			msg.Signals = append(msg.Signals, sig)
+			signals[key][sig.Name] = sig
+		}
+		for _, sig := range multiplexed {
+			sig.Multiplexer = muxSwitch
+		}
+		messages = append(messages, msg)
+	}
+
+	// Value tables and float types refer to signals by message and name
+	lookup := func(id dbc.MessageID, name dbc.Identifier) *dbcSignal {
+		return signals[dbcKey{ID: uint32(id.ToCAN()), Extended: id.IsExtended()}][string(name)]
+	}
+	for _, def := range parser.Defs() {
+		switch def := def.(type) {
+		case *dbc.ValueDescriptionsDef:
+			sig := lookup(def.MessageID, def.SignalName)
+			if def.ObjectType != dbc.ObjectTypeSignal || sig == nil {
+				continue
+			}
+			sig.Values = make(map[int64]string)
+			for _, value := range def.ValueDescriptions {
+				sig.Values[int64(value.Value)] = value.Description
+			}
+		case *dbc.SignalValueTypeDef:
+			sig := lookup(def.MessageID, def.SignalName)
+			if sig == nil {
+				continue
+			}
+			switch def.SignalValueType {
+			case dbc.SignalValueTypeFloat32:
+				sig.FloatSize = 32
+			case dbc.SignalValueTypeFloat64:
+				sig.FloatSize = 64
+			}
+		}
+	}
+
+	// Extended multiplexing names the switch and its values of a signal
+	for _, match := range muxValuesPattern.FindAllSubmatch(data, -1) {
+		id, _ := strconv.ParseUint(string(match[1]), 10, 32)
+		sig := lookup(dbc.MessageID(id), dbc.Identifier(match[2]))
+		muxSwitch := lookup(dbc.MessageID(id), dbc.Identifier(match[3]))
+		if sig == nil || muxSwitch == nil || sig == muxSwitch {
+			continue
+		}
+		sig.Multiplexer = muxSwitch
+		sig.MuxRanges = nil
+		for _, r := range muxRangePattern.FindAllSubmatch(match[4], -1) {
+			from, _ := strconv.ParseUint(string(r[1]), 10, 64)
+			to, _ := strconv.ParseUint(string(r[2]), 10, 64)
+			sig.MuxRanges = append(sig.MuxRanges, muxRange{From: from, To: to})
+		}
+	}
+
+	for _, msg := range messages {
+		key := dbcKey{ID: msg.ID, Extended: msg.Extended}
+		if _, ok := db.messages[key]; ok {
+			Log(WARNING, "DBC message %s of %s replaces an earlier definition", formatID(msg.ID, msg.Extended), path)
+		}
+		db.messages[key] = msg
+	}
+	return nil
+}
+
+// message returns the definition of the message carried by frame, nil if the
+// database does not define it. It is safe to call on a nil database.
+func (db *dbcDatabase) message(frame Frame) *dbcMessage {
+	if frame.IsError || frame.IsRemote {
+		return nil
+	}
+	return db.lookup(frame.ID, frame.IsExtended)
+}
+
+// lookup returns the definition of a message by identifier, nil if the
+// database does not define it. It is safe to call on a nil database.
+func (db *dbcDatabase) lookup(id uint32, extended bool) *dbcMessage {
+	if db == nil {
+		return nil
+	}
+	return db.messages[dbcKey{ID: id, Extended: extended}]
+}
+
+// messageByName returns the definition of a message by name, nil if the
+// database does not define it. It is safe to call on a nil database.
+func (db *dbcDatabase) messageByName(name string) *dbcMessage {
+	if db == nil {
+		return nil
+	}
+	for _, msg := range db.messages {
+		if msg.Name == name {
+			return msg
+		}
+	}
+	return nil
+}
+
+// bitPositions returns the positions of the bits of the signal in the
+// payload, most significant bit first. Bit n is bit n%8 of byte n/8.
+func (s *dbcSignal) bitPositions() []int {
+	positions := make([]int, s.Size)
+	if s.BigEndian {
+		// Motorola: counting down within a byte, then on to the next byte
+		pos := s.StartBit
+		for i := range positions {
+			positions[i] = pos
+			if pos%8 == 0 {
+				pos += 15
+			} else {
+				pos--
+			}
+		}
+		return positions
+	}
+	for i := range positions {
+		positions[i] = s.StartBit + s.Size - 1 - i
+	}
+	return positions
+}
+
+// extract returns the raw bits of the signal. ok is false if the signal does
+// not fit into data.
+func (s *dbcSignal) extract(data []byte) (raw uint64, ok bool) {
+	for _, pos := range s.bitPositions() {
+		if pos < 0 || pos/8 >= len(data) {
+			return 0, false
+		}
+		raw = raw<<1 | uint64(data[pos/8]>>(pos%8)&1)
+	}
+	return raw, true
+}
+
+// insert writes the raw bits of the signal into data. ok is false if the
+// signal does not fit into data.
+func (s *dbcSignal) insert(data []byte, raw uint64) (ok bool) {
+	positions := s.bitPositions()
+	for _, pos := range positions {
+		if pos < 0 || pos/8 >= len(data) {
+			return false
+		}
+	}
+	for i, pos := range positions {
+		bit := byte(raw>>(len(positions)-1-i)) & 1
+		data[pos/8] = data[pos/8]&^(1<<(pos%8)) | bit<<(pos%8)
+	}
+	return true
+}
+
+// rawValue converts the raw bits of the signal to its unscaled value,
+// sign-extending signed and decoding float signals.
+func (s *dbcSignal) rawValue(raw uint64) float64 {
+	switch {
+	case s.FloatSize == 32:
+		return float64(math.Float32frombits(uint32(raw)))
+	case s.FloatSize == 64:
+		return math.Float64frombits(raw)
+	case s.Signed:
+		return float64(s.signedRaw(raw))
+	}
+	return float64(raw)
+}
+
+// signedRaw sign-extends the raw bits of the signal.
+func (s *dbcSignal) signedRaw(raw uint64) int64 {
+	shift := 64 - s.Size
+	return int64(raw<<shift) >> shift
+}
+
+// physical converts the raw bits of the signal to its physical value.
+func (s *dbcSignal) physical(raw uint64) float64 {
+	return s.rawValue(raw)*s.Factor + s.Offset
+}
+
+// description returns the value table text of the raw bits, empty if there
+// is none.
+func (s *dbcSignal) description(raw uint64) string {
+	if s.Values == nil || s.FloatSize != 0 {
+		return ""
+	}
+	if s.Signed {
+		return s.Values[s.signedRaw(raw)]
+	}
+	return s.Values[int64(raw)]
+}
+
+// choices returns the raw values offered for the signal in ascending
+// order: its value table, or the values selecting signals for multiplexer
+// switches without one.
+func (m *dbcMessage) choices(sig *dbcSignal) []uint64 {
+	if len(sig.Values) == 0 {
+		if sig.MuxSwitch {
+			return m.muxValues(sig)
+		}
+		return nil
+	}
+	choices := make([]uint64, 0, len(sig.Values))
+	for raw := range sig.Values {
+		choices = append(choices, uint64(raw)&(math.MaxUint64>>(64-sig.Size)))
+	}
+	sort.Slice(choices, func(i, j int) bool { return choices[i] < choices[j] })
+	return choices
+}
+
+// encode converts a physical value to the raw bits of the signal. It fails
+// if the value is outside of the min/max range of the signal or can not be
+// represented with its size.
+func (s *dbcSignal) encode(physical float64) (uint64, error) {
+	if s.Min < s.Max && (physical < s.Min || physical > s.Max) {
+		return 0, fmt.Errorf("%s is outside of %s … %s", s.formatPhysical(physical), s.formatPhysical(s.Min), s.formatPhysical(s.Max))
+	}
+	value := (physical - s.Offset) / s.Factor
+	switch s.FloatSize {
+	case 32:
+		return uint64(math.Float32bits(float32(value))), nil
+	case 64:
+		return math.Float64bits(value), nil
+	}
+	value = math.Round(value)
+	if s.Signed {
+		limit := math.Ldexp(1, s.Size-1)
+		if value < -limit || value >= limit {
+			return 0, fmt.Errorf("%s does not fit into %d bits", s.formatPhysical(physical), s.Size)
+		}
+		return uint64(int64(value)) & (math.MaxUint64 >> (64 - s.Size)), nil
+	}
+	if value < 0 || value >= math.Ldexp(1, s.Size) {
+		return 0, fmt.Errorf("%s does not fit into %d bits", s.formatPhysical(physical), s.Size)
+	}
+	return uint64(value), nil
+}
+
+// parseValue parses a physical value or a value table description of the
+// signal and returns its raw bits.
+func (s *dbcSignal) parseValue(text string) (uint64, error) {
+	text = strings.TrimSpace(text)
+	for raw, description := range s.Values {
+		if strings.EqualFold(description, text) {
+			return uint64(raw) & (math.MaxUint64 >> (64 - s.Size)), nil
+		}
+	}
+	physical, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", text)
+	}
+	return s.encode(physical)
+}
+
+// formatValue renders the raw bits of the signal for editing: the value
+// table description if there is one, the physical value otherwise.
+func (s *dbcSignal) formatValue(raw uint64) string {
+	if text := s.description(raw); text != "" {
+		return text
+	}
+	return s.formatPhysical(s.physical(raw))
+}
+
+// decimals returns the number of decimals needed to show physical values of
+// the signal, derived from its factor and offset.
+func (s *dbcSignal) decimals() int {
+	decimals := 0
+	for _, v := range []float64{s.Factor, s.Offset} {
+		for d := 0; d < 9; d++ {
+			scaled := v * math.Pow10(d)
+			if math.Abs(scaled-math.Round(scaled)) < 1e-9*math.Max(1, math.Abs(scaled)) {
+				decimals = max(decimals, d)
+				break
+			}
+		}
+	}
+	return decimals
+}
+
+// formatPhysical renders a physical value of the signal.
+func (s *dbcSignal) formatPhysical(v float64) string {
+	if s.FloatSize != 0 {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', s.decimals(), 64)
+}
+
+// formatRaw renders the raw value of the signal.
+func (s *dbcSignal) formatRaw(raw uint64) string {
+	switch {
+	case s.FloatSize != 0:
+		return strconv.FormatFloat(s.rawValue(raw), 'g', -1, 64)
+	case s.Signed:
+		return strconv.FormatInt(s.signedRaw(raw), 10)
+	}
+	return strconv.FormatUint(raw, 10)
+}
+
+// signalValue is a decoded signal of a frame.
+type signalValue struct {
+	Signal   *dbcSignal
+	Raw      uint64
+	Physical float64
+	Text     string // Value table description
+	Valid    bool   // False if the signal is not contained in the payload
+}
+
+// selectedBy reports whether the signal is sent when its multiplexer switch
+// has the raw value.
+func (s *dbcSignal) selectedBy(raw uint64) bool {
+	for _, r := range s.MuxRanges {
+		if raw >= r.From && raw <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// isActive reports whether a signal is sent with the given multiplexer
+// switch values, which rawOf returns. Signals whose switch has no value are
+// not sent.
+func (m *dbcMessage) isActive(sig *dbcSignal, rawOf func(*dbcSignal) (uint64, bool)) bool {
+	// Switches may be multiplexed themselves, the depth limit stops cycles
+	for depth := 0; sig.Multiplexer != nil; depth++ {
+		raw, ok := rawOf(sig.Multiplexer)
+		if !ok || !sig.selectedBy(raw) || depth > len(m.Signals) {
+			return false
+		}
+		sig = sig.Multiplexer
+	}
+	return true
+}
+
+// muxValues returns the values of a multiplexer switch that select signals,
+// in ascending order. Ranges of more than 256 values are left out.
+func (m *dbcMessage) muxValues(muxSwitch *dbcSignal) []uint64 {
+	seen := make(map[uint64]bool)
+	var values []uint64
+	for _, sig := range m.Signals {
+		if sig.Multiplexer != muxSwitch {
+			continue
+		}
+		for _, r := range sig.MuxRanges {
+			for v := r.From; v <= r.To && v-r.From < 256; v++ {
+				if !seen[v] {
+					seen[v] = true
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// muxPage describes the active multiplexer page, "Mode = 2 (Diag)" for
+// every active switch, empty if the message is not multiplexed.
+func muxPage(values []signalValue) string {
+	var switches []string
+	for _, v := range values {
+		if v.Signal.MuxSwitch && v.Valid {
+			switches = append(switches, v.Signal.Name+" = "+v.Signal.formatRaw(v.Raw)+optionalText(v.Text))
+		}
+	}
+	return strings.Join(switches, ", ")
+}
+
+// optionalText renders a value table description in parentheses after a
+// value, nothing if there is none.
+func optionalText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return " (" + text + ")"
+}
+
+// decode decodes the signals of the message that are sent with the
+// multiplexer switch values of the payload.
+func (m *dbcMessage) decode(data []byte) []signalValue {
+	rawOf := func(sig *dbcSignal) (uint64, bool) {
+		return sig.extract(data)
+	}
+	var values []signalValue
+	for _, sig := range m.Signals {
+		if !m.isActive(sig, rawOf) {
+			continue
+		}
+		value := signalValue{Signal: sig}
+		if raw, ok := sig.extract(data); ok {
+			value = signalValue{Signal: sig, Raw: raw, Physical: sig.physical(raw), Text: sig.description(raw), Valid: true}
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// String renders the value as "name=value unit (description)".
+func (v signalValue) String() string {
+	if !v.Valid {
+		return v.Signal.Name + "=-"
+	}
+	s := v.Signal.Name + "=" + v.Signal.formatPhysical(v.Physical)
+	if v.Signal.Unit != "" {
+		s += " " + v.Signal.Unit
+	}
+	return s + optionalText(v.Text)
+}
+
+// signalTable renders the decoded signals of a frame as a table with
+// aligned columns, at most maxRows signal rows.
+func signalTable(values []signalValue, maxRows int) string {
+	rows := [][]string{{"Signal", "Value", "Unit", "Raw", "Min", "Max", "Description"}}
+	for _, v := range values {
+		sig := v.Signal
+		row := []string{sig.Name, "-", sig.Unit, "-", sig.formatPhysical(sig.Min), sig.formatPhysical(sig.Max), ""}
+		if v.Valid {
+			row[1] = sig.formatPhysical(v.Physical)
+			row[3] = sig.formatRaw(v.Raw)
+			row[6] = v.Text
+		}
+		rows = append(rows, row)
+	}
+
+	hidden := 0
+	if maxRows >= 0 && len(rows)-1 > maxRows {
+		hidden = len(rows) - 1 - maxRows
+		rows = rows[:maxRows+1]
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			format := "%-*s"
+			if i == 1 || i == 3 || i == 4 || i == 5 {
+				format = "%*s" // Numbers are right aligned
+			}
+			cells[i] = fmt.Sprintf(format, widths[i], cell)
+		}
+		b.WriteString(strings.TrimRight(strings.Join(cells, "  "), " ") + "\n")
+	}
+	if hidden > 0 {
+		fmt.Fprintf(&b, "... %d more signals\n", hidden)
+	}
+	return b.String()
+}
+
+// unknownMessageName marks messages of the receive table that are not
+// defined in the loaded DBC files.
+const unknownMessageName = "? unknown"
+
+// displayName renders the name and transmitting node of a message for the
+// receive table, "EngineData (ECU1)".
+func (m *dbcMessage) displayName() string {
+	if m.Transmitter == "" {
+		return m.Name
+	}
+	return m.Name + " (" + m.Transmitter + ")"
+}
+
+// dbcMessageLine describes a DBC message for the detail view.
+func dbcMessageLine(msg *dbcMessage) string {
+	line := "Message: " + msg.Name
+	if msg.Transmitter != "" {
+		line += " | Transmitter: " + msg.Transmitter
+	}
+	return line + fmt.Sprintf(" | Length: %d | Signals: %d", msg.Size, len(msg.Signals))
+}
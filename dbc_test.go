@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testDBC defines signals of both byte orders crossing byte boundaries,
+// signed signals, limits and a value table.
+const testDBC = `VERSION ""
+
+NS_ :
+
+BS_:
+
+BU_: ECU
+
+BO_ 291 Engine: 8 ECU
+ SG_ Speed : 4|12@1+ (0.5,0) [0|2000] "km/h" Vector__XXX
+ SG_ Temp : 16|8@1- (1,0) [-40|100] "degC" Vector__XXX
+ SG_ Torque : 31|12@0- (0.25,0) [-500|500] "Nm" Vector__XXX
+ SG_ Gear : 40|3@1+ (1,0) [0|7] "" Vector__XXX
+ SG_ Delta : 48|8@1- (1,0) [0|0] "" Vector__XXX
+ SG_ Counter : 56|4@1+ (1,0) [0|0] "" Vector__XXX
+
+VAL_ 291 Gear 0 "Park" 1 "Reverse" 2 "Neutral" 3 "Drive, sport" ;
+`
+
+// testDBCData is a payload of the Engine message of testDBC: Speed 0xABC,
+// Temp -20, Torque -200 raw, Gear 3, Delta -128 and Counter 9.
+var testDBCData = []byte{0xC0, 0xAB, 0xEC, 0xF3, 0x80, 0x03, 0x80, 0x09}
+
+// loadTestDBC parses a DBC file given as a string.
+func loadTestDBC(t *testing.T, dbc string) *dbcDatabase {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.dbc")
+	if err := os.WriteFile(path, []byte(dbc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDBC([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// useTestDBC loads a DBC file given as a string as signalDB for the rest of
+// the test.
+func useTestDBC(t *testing.T, dbc string) {
+	t.Helper()
+	db := loadTestDBC(t, dbc)
+	saved := signalDB
+	signalDB = db
+	t.Cleanup(func() { signalDB = saved })
+}
+
+// testSignal returns a signal of a message of the test database.
+func testSignal(t *testing.T, msg *dbcMessage, name string) *dbcSignal {
+	t.Helper()
+	for _, sig := range msg.Signals {
+		if sig.Name == name {
+			return sig
+		}
+	}
+	t.Fatalf("message %s has no signal %s", msg.Name, name)
+	return nil
+}
+
+func TestDBCBitPositions(t *testing.T) {
+	msg := loadTestDBC(t, testDBC).lookup(0x123, false)
+	tests := []struct {
+		signal    string
+		positions []int
+	}{
+		// Intel: from the most significant bit in the second byte down
+		{"Speed", []int{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4}},
+		// Motorola: down within the fourth byte, then on in the fifth
+		{"Torque", []int{31, 30, 29, 28, 27, 26, 25, 24, 39, 38, 37, 36}},
+	}
+	for _, tt := range tests {
+		if got := testSignal(t, msg, tt.signal).bitPositions(); !slices.Equal(got, tt.positions) {
+			t.Errorf("%s: got %v, want %v", tt.signal, got, tt.positions)
+		}
+	}
+}
+
+func TestDBCExtractInsert(t *testing.T) {
+	msg := loadTestDBC(t, testDBC).lookup(0x123, false)
+	tests := []struct {
+		signal   string
+		raw      uint64
+		physical float64
+	}{
+		{"Speed", 0xABC, 1374},
+		{"Temp", 0xEC, -20},
+		{"Torque", 0xF38, -50},
+		{"Gear", 3, 3},
+		{"Delta", 0x80, -128},
+		{"Counter", 9, 9},
+	}
+	data := make([]byte, len(testDBCData))
+	for _, tt := range tests {
+		sig := testSignal(t, msg, tt.signal)
+		raw, ok := sig.extract(testDBCData)
+		if !ok || raw != tt.raw || sig.physical(raw) != tt.physical {
+			t.Errorf("%s: extracted %#x (%v), %v, want %#x (%v)", tt.signal, raw, sig.physical(raw), ok, tt.raw, tt.physical)
+		}
+		if !sig.insert(data, tt.raw) {
+			t.Errorf("%s: insert failed", tt.signal)
+		}
+
+		// Inserting leaves the bits of other signals alone
+		ones := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+		sig.insert(ones, 0)
+		cleared := 0
+		for _, b := range ones {
+			cleared += 8 - bits.OnesCount8(b)
+		}
+		if raw, _ := sig.extract(ones); raw != 0 || cleared != sig.Size {
+			t.Errorf("%s: got %#x after inserting 0 with %d bits cleared", tt.signal, raw, cleared)
+		}
+	}
+	if !slices.Equal(data, testDBCData) {
+		t.Errorf("inserted % X, want % X", data, testDBCData)
+	}
+
+	// Signals beyond a short payload are not decoded nor written
+	torque := testSignal(t, msg, "Torque")
+	if _, ok := torque.extract(testDBCData[:4]); ok {
+		t.Error("signal extracted from a payload that is too short")
+	}
+	if torque.insert(make([]byte, 4), 1) {
+		t.Error("signal inserted into a payload that is too short")
+	}
+}
+
+func TestDBCEncode(t *testing.T) {
+	msg := loadTestDBC(t, testDBC).lookup(0x123, false)
+	tests := []struct {
+		signal   string
+		physical float64
+		raw      uint64
+		ok       bool
+	}{
+		{"Speed", 1374, 0xABC, true},
+		{"Speed", 2000, 4000, true},
+		{"Speed", 2000.5, 0, false}, // Above the maximum
+		{"Speed", -1, 0, false},     // Below the minimum
+		{"Temp", -20, 0xEC, true},
+		{"Temp", -40, 0xD8, true},
+		{"Temp", -41, 0, false},
+		{"Torque", -50, 0xF38, true},
+		{"Torque", -0.3, 0xFFF, true}, // Rounded to -1 raw
+		{"Torque", 500, 0x7D0, true},
+		{"Torque", 500.25, 0, false},
+		{"Delta", -128, 0x80, true}, // No limits, only the size
+		{"Delta", 127, 0x7F, true},
+		{"Delta", 128, 0, false},
+		{"Delta", -129, 0, false},
+		{"Counter", 15, 15, true},
+		{"Counter", 16, 0, false},
+		{"Counter", -1, 0, false},
+	}
+	for _, tt := range tests {
+		raw, err := testSignal(t, msg, tt.signal).encode(tt.physical)
+		if (err == nil) != tt.ok || raw != tt.raw {
+			t.Errorf("%s %v: got %#x, %v, want %#x, ok %v", tt.signal, tt.physical, raw, err, tt.raw, tt.ok)
+		}
+	}
+}
+
+func TestDBCParseValue(t *testing.T) {
+	msg := loadTestDBC(t, testDBC).lookup(0x123, false)
+	tests := []struct {
+		signal string
+		text   string
+		raw    uint64
+		ok     bool
+	}{
+		{"Gear", "Drive, sport", 3, true},
+		{"Gear", " neutral ", 2, true}, // Descriptions ignore case and spaces
+		{"Gear", "1", 1, true},
+		{"Gear", "8", 0, false}, // Above the maximum
+		{"Gear", "Overdrive", 0, false},
+		{"Speed", "1374", 0xABC, true},
+		{"Speed", "1374.0", 0xABC, true},
+		{"Speed", "2001", 0, false},
+		{"Speed", "fast", 0, false},
+		{"Speed", "", 0, false},
+		{"Temp", "-20", 0xEC, true},
+		{"Temp", "-41", 0, false},
+		{"Torque", "-50", 0xF38, true},
+		{"Torque", "-501", 0, false},
+	}
+	for _, tt := range tests {
+		raw, err := testSignal(t, msg, tt.signal).parseValue(tt.text)
+		if (err == nil) != tt.ok || raw != tt.raw {
+			t.Errorf("%s %q: got %#x, %v, want %#x, ok %v", tt.signal, tt.text, raw, err, tt.raw, tt.ok)
+		}
+	}
+}
+
+func TestDBCEncodeDecodeRoundTrip(t *testing.T) {
+	msg := loadTestDBC(t, testDBC).lookup(0x123, false)
+	values := map[string][]float64{
+		"Speed":   {0, 0.5, 1374, 2000},
+		"Temp":    {-40, -1, 0, 100},
+		"Torque":  {-500, -0.25, 0, 0.25, 499.75},
+		"Gear":    {0, 7},
+		"Delta":   {-128, -1, 127},
+		"Counter": {0, 15},
+	}
+	for name, physicals := range values {
+		sig := testSignal(t, msg, name)
+		for _, physical := range physicals {
+			data := slices.Clone(testDBCData)
+			raw, err := sig.encode(physical)
+			if err != nil || !sig.insert(data, raw) {
+				t.Errorf("%s %v: encode failed: %v", name, physical, err)
+				continue
+			}
+			for _, v := range msg.decode(data) {
+				if v.Signal == sig && (!v.Valid || v.Physical != physical) {
+					t.Errorf("%s %v: decoded %v", name, physical, v)
+				}
+				// The other signals keep their values
+				if v.Signal != sig {
+					if want, _ := v.Signal.extract(testDBCData); v.Raw != want {
+						t.Errorf("%s %v: changed %s to %#x", name, physical, v.Signal.Name, v.Raw)
+					}
+				}
+			}
+		}
+	}
+}
+
+// testMuxDBC defines a message with simple multiplexing and one with nested
+// switches and value ranges of extended multiplexing.
+const testMuxDBC = `VERSION ""
+
+NS_ :
+
+BS_:
+
+BU_: ECU
+
+BO_ 1024 Simple: 8 ECU
+ SG_ Mode M : 0|8@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ Always : 8|8@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ PageA m1 : 16|16@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ PageB m2 : 16|8@1+ (1,0) [0|0] "" Vector__XXX
+
+BO_ 1025 Nested: 8 ECU
+ SG_ Service M : 0|8@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ Subfunction m1M : 8|8@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ Session m16 : 16|8@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ Key m39 : 16|16@1+ (1,0) [0|0] "" Vector__XXX
+ SG_ Dtc m2 : 8|24@1+ (1,0) [0|0] "" Vector__XXX
+
+SG_MUL_VAL_ 1025 Subfunction Service 1-1;
+SG_MUL_VAL_ 1025 Session Subfunction 16-16;
+SG_MUL_VAL_ 1025 Key Subfunction 39-40;
+SG_MUL_VAL_ 1025 Dtc Service 2-3, 5-5;
+`
+
+func TestDBCPreprocessExtendedMux(t *testing.T) {
+	data, switches := preprocess([]byte(testMuxDBC))
+	if !bytes.Contains(data, []byte(" SG_ Subfunction m1 : 8|8@1+")) {
+		t.Errorf("switch m1M not rewritten:\n%s", data)
+	}
+	if len(switches) != 1 || len(switches[1025]) != 1 || !switches[1025]["Subfunction"] {
+		t.Errorf("switches = %v, want Subfunction of message 1025", switches)
+	}
+}
+
+func TestDBCMultiplexing(t *testing.T) {
+	db := loadTestDBC(t, testMuxDBC)
+	tests := []struct {
+		name    string
+		id      uint32
+		data    []byte
+		signals []string
+	}{
+		{"simple page 1", 1024, []byte{1, 0, 0, 0}, []string{"Mode", "Always", "PageA"}},
+		{"simple page 2", 1024, []byte{2, 0, 0, 0}, []string{"Mode", "Always", "PageB"}},
+		{"simple unknown page", 1024, []byte{3, 0, 0, 0}, []string{"Mode", "Always"}},
+		{"nested session", 1025, []byte{1, 16, 0, 0}, []string{"Service", "Subfunction", "Session"}},
+		{"nested range start", 1025, []byte{1, 39, 0, 0}, []string{"Service", "Subfunction", "Key"}},
+		{"nested range end", 1025, []byte{1, 40, 0, 0}, []string{"Service", "Subfunction", "Key"}},
+		{"nested unknown subfunction", 1025, []byte{1, 41, 0, 0}, []string{"Service", "Subfunction"}},
+		// Session needs Subfunction 16 and Subfunction needs Service 1
+		{"nested inactive switch", 1025, []byte{16, 16, 0, 0}, []string{"Service"}},
+		{"ranges first", 1025, []byte{2, 16, 0, 0}, []string{"Service", "Dtc"}},
+		{"ranges last", 1025, []byte{3, 0, 0, 0}, []string{"Service", "Dtc"}},
+		{"ranges gap", 1025, []byte{4, 0, 0, 0}, []string{"Service"}},
+		{"ranges second", 1025, []byte{5, 0, 0, 0}, []string{"Service", "Dtc"}},
+	}
+	for _, tt := range tests {
+		var signals []string
+		for _, v := range db.lookup(tt.id, false).decode(tt.data) {
+			signals = append(signals, v.Signal.Name)
+		}
+		if !slices.Equal(signals, tt.signals) {
+			t.Errorf("%s: decoded %v, want %v", tt.name, signals, tt.signals)
+		}
+	}
+}
+
+func TestDBCMuxValues(t *testing.T) {
+	db := loadTestDBC(t, testMuxDBC)
+	simple, nested := db.lookup(1024, false), db.lookup(1025, false)
+	tests := []struct {
+		msg    *dbcMessage
+		signal string
+		values []uint64
+	}{
+		{simple, "Mode", []uint64{1, 2}},
+		{nested, "Service", []uint64{1, 2, 3, 5}},
+		{nested, "Subfunction", []uint64{16, 39, 40}},
+		{nested, "Session", nil},
+	}
+	for _, tt := range tests {
+		sig := testSignal(t, tt.msg, tt.signal)
+		if got := tt.msg.muxValues(sig); !slices.Equal(got, tt.values) {
+			t.Errorf("%s: got %v, want %v", tt.signal, got, tt.values)
+		}
+		if sig.MuxSwitch != (tt.values != nil) {
+			t.Errorf("%s: switch flag %v", tt.signal, sig.MuxSwitch)
+		}
+		// Switches without a value table offer the values selecting signals
+		if got := tt.msg.choices(sig); !slices.Equal(got, tt.values) {
+			t.Errorf("%s: choices %v, want %v", tt.signal, got, tt.values)
+		}
+	}
+}
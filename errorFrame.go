@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error frame identifier flags and classes as defined in linux/can.h and
+// linux/can/error.h.
+const (
+	CAN_ERR_FLAG = 0x20000000
+	CAN_ERR_MASK = 0x1FFFFFFF
+	CAN_ERR_DLC  = 8
+
+	CAN_ERR_TX_TIMEOUT = 0x00000001
+	CAN_ERR_LOSTARB    = 0x00000002
+	CAN_ERR_CRTL       = 0x00000004
+	CAN_ERR_PROT       = 0x00000008
+	CAN_ERR_TRX        = 0x00000010
+	CAN_ERR_ACK        = 0x00000020
+	CAN_ERR_BUSOFF     = 0x00000040
+	CAN_ERR_BUSERROR   = 0x00000080
+	CAN_ERR_RESTARTED  = 0x00000100
+	CAN_ERR_CNT        = 0x00000200 // TX/RX error counters in data[6] and data[7] are valid
+)
+
+// Controller status bits in data[1].
+const (
+	CAN_ERR_CRTL_RX_OVERFLOW = 0x01
+	CAN_ERR_CRTL_TX_OVERFLOW = 0x02
+	CAN_ERR_CRTL_RX_WARNING  = 0x04
+	CAN_ERR_CRTL_TX_WARNING  = 0x08
+	CAN_ERR_CRTL_RX_PASSIVE  = 0x10
+	CAN_ERR_CRTL_TX_PASSIVE  = 0x20
+	CAN_ERR_CRTL_ACTIVE      = 0x40
+)
+
+var errorClassNames = []struct {
+	bit  uint32
+	name string
+}{
+	{CAN_ERR_TX_TIMEOUT, "TX timeout"},
+	{CAN_ERR_LOSTARB, "lost arbitration"},
+	{CAN_ERR_CRTL, "controller"},
+	{CAN_ERR_PROT, "protocol violation"},
+	{CAN_ERR_TRX, "transceiver"},
+	{CAN_ERR_ACK, "no ACK"},
+	{CAN_ERR_BUSOFF, "bus off"},
+	{CAN_ERR_BUSERROR, "bus error"},
+	{CAN_ERR_RESTARTED, "controller restarted"},
+}
+
+var controllerErrorNames = []struct {
+	bit  uint8
+	name string
+}{
+	{CAN_ERR_CRTL_RX_OVERFLOW, "RX buffer overflow"},
+	{CAN_ERR_CRTL_TX_OVERFLOW, "TX buffer overflow"},
+	{CAN_ERR_CRTL_RX_WARNING, "RX warning"},
+	{CAN_ERR_CRTL_TX_WARNING, "TX warning"},
+	{CAN_ERR_CRTL_RX_PASSIVE, "RX passive"},
+	{CAN_ERR_CRTL_TX_PASSIVE, "TX passive"},
+	{CAN_ERR_CRTL_ACTIVE, "back to error active"},
+}
+
+var protocolErrorNames = []struct {
+	bit  uint8
+	name string
+}{
+	{0x01, "single bit error"},
+	{0x02, "frame format error"},
+	{0x04, "bit stuffing error"},
+	{0x08, "unable to send dominant bit"},
+	{0x10, "unable to send recessive bit"},
+	{0x20, "bus overload"},
+	{0x40, "active error announcement"},
+	{0x80, "error on transmission"},
+}
+
+var protocolLocationNames = map[uint8]string{
+	0x03: "start of frame",
+	0x02: "ID bits 28-21",
+	0x06: "ID bits 20-18",
+	0x04: "substitute RTR",
+	0x05: "identifier extension",
+	0x07: "ID bits 17-13",
+	0x0F: "ID bits 12-5",
+	0x0E: "ID bits 4-0",
+	0x0C: "RTR bit",
+	0x0D: "reserved bit 1",
+	0x09: "reserved bit 0",
+	0x0B: "data length code",
+	0x0A: "data section",
+	0x08: "CRC sequence",
+	0x18: "CRC delimiter",
+	0x19: "ACK slot",
+	0x1B: "ACK delimiter",
+	0x1A: "end of frame",
+	0x12: "intermission",
+}
+
+var transceiverErrorNames = map[uint8]string{
+	0x04: "CAN_H no wire",
+	0x05: "CAN_H short to BAT",
+	0x06: "CAN_H short to VCC",
+	0x07: "CAN_H short to GND",
+	0x40: "CAN_L no wire",
+	0x50: "CAN_L short to BAT",
+	0x60: "CAN_L short to VCC",
+	0x70: "CAN_L short to GND",
+	0x80: "CAN_L short to CAN_H",
+}
+
+// CANError is the decoded content of a SocketCAN error frame.
+type CANError struct {
+	Class          uint32 // CAN_ERR_* class bits
+	ArbitrationBit uint8  // Bit in which arbitration was lost, 0 if unknown
+	Controller     uint8  // CAN_ERR_CRTL_* status bits
+	Protocol       uint8  // Protocol violation type bits
+	Location       uint8  // Protocol violation location
+	Transceiver    uint8  // Transceiver status
+	HasCounters    bool   // TxErrorCounter and RxErrorCounter are valid
+	TxErrorCounter uint8
+	RxErrorCounter uint8
+}
+
+// decodeCANError decodes the payload of an error frame.
+func decodeCANError(frame Frame) CANError {
+	e := CANError{
+		Class:          frame.ID,
+		ArbitrationBit: frame.Data[0],
+		Controller:     frame.Data[1],
+		Protocol:       frame.Data[2],
+		Location:       frame.Data[3],
+		Transceiver:    frame.Data[4],
+		TxErrorCounter: frame.Data[6],
+		RxErrorCounter: frame.Data[7],
+	}
+	// Older kernels do not set CAN_ERR_CNT but most drivers still report
+	// the counters together with controller problems
+	e.HasCounters = frame.ID&CAN_ERR_CNT != 0 || (frame.ID&CAN_ERR_CRTL != 0 && (e.TxErrorCounter != 0 || e.RxErrorCounter != 0))
+	return e
+}
+
+// ControllerState returns the controller state announced by the error
+// frame, or an empty string if the frame carries no state change.
+func (e CANError) ControllerState() string {
+	switch {
+	case e.Class&CAN_ERR_BUSOFF != 0:
+		return "BUS-OFF"
+	case e.Class&CAN_ERR_RESTARTED != 0:
+		return "ERROR-ACTIVE"
+	case e.Class&CAN_ERR_CRTL == 0:
+		return ""
+	case e.Controller&(CAN_ERR_CRTL_RX_PASSIVE|CAN_ERR_CRTL_TX_PASSIVE) != 0:
+		return "ERROR-PASSIVE"
+	case e.Controller&(CAN_ERR_CRTL_RX_WARNING|CAN_ERR_CRTL_TX_WARNING) != 0:
+		return "ERROR-WARNING"
+	case e.Controller&CAN_ERR_CRTL_ACTIVE != 0:
+		return "ERROR-ACTIVE"
+	default:
+		return ""
+	}
+}
+
+// Classes returns the names of all error classes set in the frame.
+func (e CANError) Classes() []string {
+	var names []string
+	for _, c := range errorClassNames {
+		if e.Class&c.bit != 0 {
+			names = append(names, c.name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, "unspecified")
+	}
+	return names
+}
+
+// Details returns one human readable line per error class with the
+// information of the payload bytes belonging to it.
+func (e CANError) Details() []string {
+	var details []string
+	if e.Class&CAN_ERR_LOSTARB != 0 && e.ArbitrationBit != 0 {
+		details = append(details, fmt.Sprintf("lost arbitration in bit %d", e.ArbitrationBit))
+	}
+	if e.Class&CAN_ERR_CRTL != 0 {
+		var names []string
+		for _, c := range controllerErrorNames {
+			if e.Controller&c.bit != 0 {
+				names = append(names, c.name)
+			}
+		}
+		if len(names) == 0 {
+			names = append(names, "unspecified")
+		}
+		details = append(details, "controller: "+strings.Join(names, ", "))
+	}
+	if e.Class&CAN_ERR_PROT != 0 {
+		var names []string
+		for _, p := range protocolErrorNames {
+			if e.Protocol&p.bit != 0 {
+				names = append(names, p.name)
+			}
+		}
+		if len(names) == 0 {
+			names = append(names, "unspecified")
+		}
+		location, ok := protocolLocationNames[e.Location]
+		if !ok {
+			location = "unspecified"
+		}
+		details = append(details, fmt.Sprintf("protocol: %s at %s", strings.Join(names, ", "), location))
+	}
+	if e.Class&CAN_ERR_TRX != 0 {
+		name, ok := transceiverErrorNames[e.Transceiver]
+		if !ok {
+			name = "unspecified"
+		}
+		details = append(details, "transceiver: "+name)
+	}
+	if e.HasCounters {
+		details = append(details, fmt.Sprintf("TEC %d / REC %d", e.TxErrorCounter, e.RxErrorCounter))
+	}
+	return details
+}
+
+// String returns a one line summary of the error frame.
+func (e CANError) String() string {
+	// Controller, protocol and transceiver problems are named by their details
+	var parts []string
+	for _, c := range errorClassNames {
+		detailed := c.bit&(CAN_ERR_CRTL|CAN_ERR_PROT|CAN_ERR_TRX) != 0 || (c.bit == CAN_ERR_LOSTARB && e.ArbitrationBit != 0)
+		if e.Class&c.bit != 0 && !detailed {
+			parts = append(parts, c.name)
+		}
+	}
+	parts = append(parts, e.Details()...)
+	if len(parts) == 0 {
+		return "unspecified"
+	}
+	return strings.Join(parts, "; ")
+}
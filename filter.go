@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// filterChannelSeparator separates the channel of a filter list entry from
+// the message, "EngineData@can0". Entries without a channel match all
+// channels.
+const filterChannelSeparator = "@"
+
+// inFilterList reports whether messages with the given key are in the filter
+// list, either for their channel or for all channels.
+func (m Model) inFilterList(key msgKey) bool {
+	if _, ok := m.filteredIDs[key]; ok {
+		return true
+	}
+	key.Channel = ""
+	_, ok := m.filteredIDs[key]
+	return ok
+}
+
+// parseFilterEntry parses an entry of the filter list: a DBC message name or
+// an identifier as rendered by formatKey, optionally followed by
+// filterChannelSeparator and a channel.
+func parseFilterEntry(s string) (msgKey, error) {
+	s = strings.TrimSpace(s)
+	channel := ""
+	if i := strings.LastIndex(s, filterChannelSeparator); i >= 0 {
+		s, channel = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	if dbcMsg := signalDB.messageByName(s); dbcMsg != nil {
+		return msgKey{Channel: channel, ID: dbcMsg.ID, Extended: dbcMsg.Extended}, nil
+	}
+	key, err := parseID(s)
+	if err != nil {
+		if signalDB != nil {
+			return msgKey{}, fmt.Errorf("'%s' is neither a message of the DBC files nor an ID", s)
+		}
+		return msgKey{}, fmt.Errorf("invalid ID '%s'", s)
+	}
+	key.Channel = channel
+	return key, nil
+}
+
+// formatFilterEntry renders a key of the filter list, using the DBC message
+// name where there is one.
+func formatFilterEntry(key msgKey) string {
+	s := formatKey(key)
+	if dbcMsg := signalDB.lookup(key.ID, key.Extended); dbcMsg != nil && !key.Error {
+		s = dbcMsg.Name
+	}
+	if key.Channel != "" {
+		s += filterChannelSeparator + key.Channel
+	}
+	return s
+}
+
+// parseFilterList parses a comma separated filter list.
+func parseFilterList(s string) (map[msgKey]struct{}, error) {
+	keys := make(map[msgKey]struct{})
+	for _, entry := range strings.Split(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, err := parseFilterEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		keys[key] = struct{}{}
+	}
+	return keys, nil
+}
+
+// formatFilterList renders the filter list, sorted.
+func formatFilterList(keys map[msgKey]struct{}) string {
+	entries := make([]string, 0, len(keys))
+	for key := range keys {
+		entries = append(entries, formatFilterEntry(key))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
+
+// openFilterPrompt starts editing the filter list in the status bar.
+func (m *Model) openFilterPrompt() {
+	m.filterInput = textinput.New()
+	m.filterInput.Prompt = "Filter list: "
+	m.filterInput.Placeholder = "EngineData, 0x123, 0x18FEF100@can1"
+	m.filterInput.SetValue(formatFilterList(m.filteredIDs))
+	m.filterInput.Focus()
+	m.filterErr = ""
+	m.editingFilter = true
+}
+
+// updateFilterPrompt handles keys while the filter list is edited. enter
+// replaces the filter list, esc discards the changes.
+func updateFilterPrompt(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.editingFilter = false
+		return m, nil
+	case "enter":
+		keys, err := parseFilterList(m.filterInput.Value())
+		if err != nil {
+			m.filterErr = err.Error()
+			return m, nil
+		}
+		m.filteredIDs = keys
+		m.editingFilter = false
+		m.receiveTable.SetRows([]table.Row{}) // Clear table on filter change
+		m.logMessages = nil
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.filterInput, cmd = m.filterInput.Update(msg)
+	m.filterErr = ""
+	return m, cmd
+}
+
+// renderFilterPrompt renders the filter list prompt in place of the status
+// bar.
+func (m Model) renderFilterPrompt() string {
+	line := " " + m.filterInput.View()
+	if m.filterErr != "" {
+		line += "  " + formErrorStyle.Render(m.filterErr)
+	}
+	return statusStyle.Width(m.width).Render(line)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+// withoutDBC unloads the DBC files for the rest of the test.
+func withoutDBC(t *testing.T) {
+	t.Helper()
+	saved := signalDB
+	signalDB = nil
+	t.Cleanup(func() { signalDB = saved })
+}
+
+func TestParseFilterEntry(t *testing.T) {
+	withoutDBC(t)
+	tests := []struct {
+		entry string
+		key   msgKey
+		ok    bool
+	}{
+		{"0x123", msgKey{ID: 0x123}, true},
+		{"123", msgKey{ID: 0x123}, true},
+		{"0x0001", msgKey{ID: 0x1, Extended: true}, true}, // More than three digits are extended
+		{" 0x18FEF100 @ can1 ", msgKey{Channel: "can1", ID: 0x18FEF100, Extended: true}, true},
+		{"0x7FF@vcan0", msgKey{Channel: "vcan0", ID: 0x7FF}, true},
+		{"0x123@", msgKey{ID: 0x123}, true},
+		{"ERR 0x040@can0", msgKey{Channel: "can0", ID: CAN_ERR_BUSOFF, Error: true}, true},
+		{"0x800", msgKey{}, false},      // Exceeds 11 bits
+		{"0x20000000", msgKey{}, false}, // Exceeds 29 bits
+		{"ERR 0x20000000", msgKey{}, false},
+		{"Engine", msgKey{}, false}, // No DBC files loaded
+		{"12X@can0", msgKey{}, false},
+		{"@can0", msgKey{}, false},
+		{"", msgKey{}, false},
+	}
+	for _, tt := range tests {
+		key, err := parseFilterEntry(tt.entry)
+		if (err == nil) != tt.ok || key != tt.key {
+			t.Errorf("parse %q = %+v, %v, want %+v", tt.entry, key, err, tt.key)
+		}
+	}
+	if _, err := parseFilterEntry("Engine"); err == nil || err.Error() != "invalid ID 'Engine'" {
+		t.Errorf("error without DBC files = %v", err)
+	}
+}
+
+func TestParseFilterEntryDBC(t *testing.T) {
+	useTestDBC(t, testDBC)
+	tests := []struct {
+		entry string
+		key   msgKey
+		ok    bool
+	}{
+		{"Engine", msgKey{ID: 0x123}, true},
+		{"Engine@can0", msgKey{Channel: "can0", ID: 0x123}, true},
+		{"0x123@can1", msgKey{Channel: "can1", ID: 0x123}, true},
+		{"engine", msgKey{}, false}, // Names are case sensitive
+		{"Gearbox@can0", msgKey{}, false},
+	}
+	for _, tt := range tests {
+		key, err := parseFilterEntry(tt.entry)
+		if (err == nil) != tt.ok || key != tt.key {
+			t.Errorf("parse %q = %+v, %v, want %+v", tt.entry, key, err, tt.key)
+		}
+	}
+	if _, err := parseFilterEntry("Gearbox"); err == nil || !strings.Contains(err.Error(), "neither a message of the DBC files nor an ID") {
+		t.Errorf("error for an unknown name = %v", err)
+	}
+}
+
+func TestFilterListRoundTrip(t *testing.T) {
+	useTestDBC(t, testDBC)
+	// Engine@can0 is the same entry as 0x123@can0, empty entries are skipped
+	keys, err := parseFilterList("0x123@can0, ,0x7FF,0x18FEF100@can1,Engine@can0,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[msgKey]struct{}{
+		{Channel: "can0", ID: 0x123}: {},
+		{ID: 0x7FF}:                  {},
+		{Channel: "can1", ID: 0x18FEF100, Extended: true}: {},
+	}
+	if !maps.Equal(keys, want) {
+		t.Errorf("parsed %v, want %v", keys, want)
+	}
+
+	// Known messages are shown by name, entries are sorted
+	list := formatFilterList(keys)
+	if list != "0x18FEF100@can1, 0x7FF, Engine@can0" {
+		t.Errorf("formatted %q", list)
+	}
+	again, err := parseFilterList(list)
+	if err != nil || !maps.Equal(again, keys) {
+		t.Errorf("parsed %q back as %v, %v", list, again, err)
+	}
+
+	if keys, err := parseFilterList("0x123, 0x800"); err == nil {
+		t.Errorf("list with an invalid entry parsed as %v", keys)
+	}
+	if keys, err := parseFilterList(" , "); err != nil || len(keys) != 0 {
+		t.Errorf("empty list parsed as %v, %v", keys, err)
+	}
+}
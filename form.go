@@ -11,98 +11,499 @@ import (
 	"github.com/google/uuid"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"go.einride.tech/can"
 )
 
+// Indices of the text inputs of the form.
+const (
+	inputID = iota
+	inputDLC
+	inputCycle
+	inputReplyID // ID of remote requests the message is sent in reply to
+	inputChannel // Bus the message is sent on
+	inputData    // First of the data byte inputs
+)
+
+// Indices of the toggles of the form.
+const (
+	toggleExtended = iota
+	toggleRemote
+	toggleFD
+	toggleBRS
+	toggleESI
+	toggleRawData // Edit the data bytes instead of the DBC signals
+	numToggles
+)
+
+// formField is a focusable element of the form: a text input, a toggle or
+// the input of a DBC signal.
+type formField struct {
+	toggle bool
+	signal bool // index is into signalInputs
+	index  int
+}
+
 // form represents the new message creation form.
 
 type form struct {
 	inputs  []textinput.Model
-	focused int
+	toggles []bool
+	focused int // Index into fields(), -1 while the form is closed
 	editingUUID string
+	err     string // Validation error shown below the inputs
+	channels []string // Names of the open buses, the first one is the default
+
+	signalMsg    *dbcMessage       // Message whose signals are edited, nil while editing bytes
+	signalInputs []textinput.Model // Physical values of the signals of signalMsg
+	signalErrs   []string          // Encoding errors of the signal inputs
 }
 
-func newForm(id, dlc, cycleTime, data string) form {
-	inputs := make([]textinput.Model, 11)
+// newForm creates a form prefilled with the values of msg. A nil msg gives
+// an empty form. channels lists the buses the message can be sent on.
+func newForm(msg *SendMessage, channels []string) form {
+	inputs := make([]textinput.Model, inputData+CANFD_MAX_DLEN)
 	for i := range inputs {
 		inputs[i] = textinput.New()
 		inputs[i].Prompt = ""
 	}
 
-	inputs[0].Placeholder = "1A"
-	inputs[0].CharLimit = 10
-	inputs[0].Width = 5
-	if id != "" {
-		inputs[0].SetValue(id)
+	inputs[inputID].Placeholder = "1A"
+	inputs[inputID].CharLimit = 10
+	inputs[inputID].Width = 10
+
+	inputs[inputDLC].Placeholder = "8"
+	inputs[inputDLC].CharLimit = 2
+	inputs[inputDLC].Width = 3
+
+	inputs[inputCycle].Placeholder = "100"
+	inputs[inputCycle].CharLimit = 5
+	inputs[inputCycle].Width = 7
+
+	inputs[inputReplyID].Placeholder = "off"
+	inputs[inputReplyID].CharLimit = 8
+	inputs[inputReplyID].Width = 10
+
+	if len(channels) > 0 {
+		inputs[inputChannel].Placeholder = channels[0]
+	}
+	inputs[inputChannel].Width = 16
+
+	for i := 0; i < CANFD_MAX_DLEN; i++ {
+		inputs[inputData+i].CharLimit = 2
+		inputs[inputData+i].Width = 3
+	}
+
+	toggles := make([]bool, numToggles)
+
+	if msg != nil {
+		inputs[inputID].SetValue(strings.TrimPrefix(formatID(msg.ID, msg.Extended), "0x"))
+		inputs[inputChannel].SetValue(msg.Channel)
+		inputs[inputDLC].SetValue(fmt.Sprintf("%d", msg.DLC))
+		if msg.CycleTime > 0 {
+			inputs[inputCycle].SetValue(fmt.Sprintf("%d", msg.CycleTime.Milliseconds()))
+		}
+		if msg.AutoReply {
+			inputs[inputReplyID].SetValue(strings.TrimPrefix(formatID(msg.AutoReplyID, msg.Extended), "0x"))
+		}
+		for i, b := range msg.Data {
+			if i < CANFD_MAX_DLEN {
+				inputs[inputData+i].SetValue(fmt.Sprintf("%02X", b))
+			}
+		}
+		toggles[toggleExtended] = msg.Extended
+		toggles[toggleRemote] = msg.Remote
+		toggles[toggleFD] = msg.FD
+		toggles[toggleBRS] = msg.BRS
+		toggles[toggleESI] = msg.ESI
+	}
+
+	f := form{inputs: inputs, toggles: toggles, focused: -1, channels: channels}
+	f.syncSignals()
+	return f
+}
+
+// fields returns the focusable elements of the form in tab order.
+func (f form) fields() []formField {
+	fields := []formField{
+		{index: inputChannel},
+		{index: inputID},
+		{toggle: true, index: toggleExtended},
+		{toggle: true, index: toggleRemote},
+		{toggle: true, index: toggleFD},
+	}
+	if f.toggles[toggleFD] {
+		fields = append(fields, formField{toggle: true, index: toggleBRS}, formField{toggle: true, index: toggleESI})
+	}
+	fields = append(fields,
+		formField{index: inputDLC},
+		formField{index: inputCycle},
+		formField{index: inputReplyID},
+	)
+	if f.dbcMessage() != nil && !f.toggles[toggleRemote] {
+		fields = append(fields, formField{toggle: true, index: toggleRawData})
+	}
+	if f.signalMsg != nil {
+		for _, i := range f.activeSignals() {
+			fields = append(fields, formField{signal: true, index: i})
+		}
+		return fields
+	}
+	for i := 0; i < f.dataInputs(); i++ {
+		fields = append(fields, formField{index: inputData + i})
+	}
+	return fields
+}
+
+// dbcMessage returns the DBC definition of the entered ID, nil if there is
+// none.
+func (f form) dbcMessage() *dbcMessage {
+	extended := f.toggles[toggleExtended]
+	id, err := parseFormID(f.inputs[inputID].Value(), extended)
+	if err != nil {
+		return nil
+	}
+	return signalDB.lookup(id, extended)
+}
+
+// syncSignals switches between the signal editor and the data byte inputs
+// when the entered ID, the remote or the raw data toggle changes. The signal
+// inputs start with the values decoded from the data bytes and are encoded
+// back, so that clamped values show in the data bytes too. An empty DLC is set
+// to the length of the DBC message.
+func (f *form) syncSignals() {
+	msg := f.dbcMessage()
+	if f.toggles[toggleRemote] || f.toggles[toggleRawData] {
+		msg = nil
+	}
+	if msg == f.signalMsg {
+		return
+	}
+	f.signalMsg = msg
+	f.signalInputs = nil
+	f.signalErrs = nil
+	if msg == nil {
+		return
+	}
+
+	if f.inputs[inputDLC].Value() == "" {
+		f.inputs[inputDLC].SetValue(strconv.Itoa(msg.Size))
+		if msg.Size > CAN_MAX_DLEN {
+			f.toggles[toggleFD] = true
+		}
+	}
+	// Signals of other multiplexer pages start at zero, or their minimum
+	data := f.dataBytes()
+	rawOf := func(sig *dbcSignal) (uint64, bool) {
+		return sig.extract(data)
+	}
+	f.signalInputs = make([]textinput.Model, len(msg.Signals))
+	f.signalErrs = make([]string, len(msg.Signals))
+	for i, sig := range msg.Signals {
+		f.signalInputs[i] = textinput.New()
+		f.signalInputs[i].Prompt = ""
+		f.signalInputs[i].CharLimit = 24
+		f.signalInputs[i].Width = 14
+		raw, ok := sig.extract(data)
+		if !ok || !msg.isActive(sig, rawOf) {
+			raw, _ = sig.encode(max(sig.Min, min(sig.Max, 0)))
+			if sig.Min >= sig.Max {
+				raw, _ = sig.encode(0)
+			}
+		}
+		f.signalInputs[i].SetValue(sig.formatValue(raw))
+	}
+	f.encodeSignals()
+}
+
+// dataBytes returns the values of all data byte inputs shown in the form.
+func (f form) dataBytes() []byte {
+	data := make([]byte, f.dataInputs())
+	for i := range data {
+		b, _ := hex.DecodeString(f.inputs[inputData+i].Value())
+		if len(b) > 0 {
+			data[i] = b[0]
+		}
+	}
+	return data
+}
+
+// encodeSignals encodes the signal inputs into the data byte inputs. Signals
+// with invalid values or outside of the DLC keep their bits and get an
+// error in signalErrs.
+func (f *form) encodeSignals() {
+	if f.signalMsg == nil {
+		return
+	}
+	data := f.dataBytes()
+	dlc, _ := strconv.Atoi(f.inputs[inputDLC].Value())
+	for i := range f.signalErrs {
+		f.signalErrs[i] = ""
+	}
+	for _, i := range f.activeSignals() {
+		sig := f.signalMsg.Signals[i]
+		raw, err := sig.parseValue(f.signalInputs[i].Value())
+		if err != nil {
+			f.signalErrs[i] = err.Error()
+			continue
+		}
+		if !sig.insert(data[:min(dlc, len(data))], raw) {
+			f.signalErrs[i] = fmt.Sprintf("outside of the DLC %d", dlc)
+		}
+	}
+	for i, b := range data {
+		f.inputs[inputData+i].SetValue(fmt.Sprintf("%02X", b))
+	}
+}
+
+// signalError returns the first encoding error of the signal inputs.
+func (f form) signalError() error {
+	for i, err := range f.signalErrs {
+		if err != "" {
+			return fmt.Errorf("%s: %s", f.signalMsg.Signals[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// cycleChoice sets the signal input to the next or previous entry of the
+// choices of its signal, see dbcMessage.choices.
+func (f *form) cycleChoice(index int, forward bool) {
+	sig := f.signalMsg.Signals[index]
+	choices := f.signalMsg.choices(sig)
+	if len(choices) == 0 {
+		return
+	}
+	next := 0
+	if raw, err := sig.parseValue(f.signalInputs[index].Value()); err == nil {
+		for i, choice := range choices {
+			if choice != raw {
+				continue
+			}
+			next = (i + 1) % len(choices)
+			if !forward {
+				next = (i + len(choices) - 1) % len(choices)
+			}
+		}
+	}
+	f.signalInputs[index].SetValue(sig.formatValue(choices[next]))
+	f.signalInputs[index].CursorEnd()
+}
+
+// switchValue returns the raw value entered for a multiplexer switch.
+func (f form) switchValue(muxSwitch *dbcSignal) (uint64, bool) {
+	for i, sig := range f.signalMsg.Signals {
+		if sig == muxSwitch {
+			raw, err := sig.parseValue(f.signalInputs[i].Value())
+			return raw, err == nil
+		}
+	}
+	return 0, false
+}
+
+// activeSignals returns the indices of the signals sent with the entered
+// multiplexer switch values.
+func (f form) activeSignals() []int {
+	var active []int
+	for i, sig := range f.signalMsg.Signals {
+		if f.signalMsg.isActive(sig, f.switchValue) {
+			active = append(active, i)
+		}
+	}
+	return active
+}
+
+// refocus moves the focus to field after the fields of the form changed,
+// to the last field if it is gone.
+func (f *form) refocus(field formField) {
+	fields := f.fields()
+	for i, other := range fields {
+		if other == field {
+			f.setFocus(i)
+			return
+		}
 	}
+	f.setFocus(min(f.focused, len(fields)-1))
+}
 
-	inputs[1].Placeholder = "8"
-	inputs[1].CharLimit = 1
-	inputs[1].Width = 3
-	if dlc != "" {
-		inputs[1].SetValue(dlc)
+// dataInputs returns the number of data byte inputs shown in the form. CAN
+// FD frames show as many inputs as the entered length needs.
+func (f form) dataInputs() int {
+	if !f.toggles[toggleFD] {
+		return CAN_MAX_DLEN
+	}
+	dlc, err := strconv.ParseUint(f.inputs[inputDLC].Value(), 10, 8)
+	if err != nil || dlc <= CAN_MAX_DLEN {
+		return CAN_MAX_DLEN
 	}
+	return int(fdDLCToLength(fdLengthToDLC(uint8(min(dlc, CANFD_MAX_DLEN)))))
+}
 
-	inputs[2].Placeholder = "100"
-	inputs[2].CharLimit = 5
-	inputs[2].Width = 7
-	if cycleTime != "" {
-		inputs[2].SetValue(cycleTime)
+// setFocus moves the focus to the n-th field of the form.
+func (f *form) setFocus(n int) {
+	for i := range f.inputs {
+		f.inputs[i].Blur()
+	}
+	for i := range f.signalInputs {
+		f.signalInputs[i].Blur()
 	}
+	f.focused = n
+	switch field := f.fields()[n]; {
+	case field.signal:
+		f.signalInputs[field.index].Focus()
+	case !field.toggle:
+		f.inputs[field.index].Focus()
+	}
+}
+
+// isFocused reports whether the given field has the focus.
+func (f form) isFocused(field formField) bool {
+	return f.focused >= 0 && f.fields()[f.focused] == field
+}
+
+// parseFormID parses a hex identifier entered in the form.
+func parseFormID(value string, extended bool) (uint32, error) {
+	id, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID '%s'", value)
+	}
+	if extended && id > can.MaxExtendedID {
+		return 0, fmt.Errorf("ID 0x%X does not fit in 29 bits", id)
+	}
+	if !extended && id > can.MaxID {
+		return 0, fmt.Errorf("ID 0x%X does not fit in 11 bits, enable the extended ID", id)
+	}
+	return uint32(id), nil
+}
 
-	dataBytes := strings.Fields(data)
-	for i := 0; i < 8; i++ {
-		inputs[i+3].CharLimit = 2
-		inputs[i+3].Width = 3
-		if i < len(dataBytes) {
-			inputs[i+3].SetValue(dataBytes[i])
+// parseChannel validates the entered channel. An empty input selects the
+// first bus.
+func (f form) parseChannel() (string, error) {
+	channel := strings.TrimSpace(f.inputs[inputChannel].Value())
+	if channel == "" {
+		return "", nil
+	}
+	for _, name := range f.channels {
+		if name == channel {
+			return channel, nil
+		}
+	}
+	return "", fmt.Errorf("unknown channel '%s', open channels are %s", channel, strings.Join(f.channels, ", "))
+}
+
+// parseMessage validates the form and copies its values into msg.
+func (f form) parseMessage(msg *SendMessage) error {
+	channel, err := f.parseChannel()
+	if err != nil {
+		return err
+	}
+
+	extended := f.toggles[toggleExtended]
+	id, err := parseFormID(f.inputs[inputID].Value(), extended)
+	if err != nil {
+		return err
+	}
+
+	autoReply := f.inputs[inputReplyID].Value() != ""
+	var replyID uint32
+	if autoReply {
+		if replyID, err = parseFormID(f.inputs[inputReplyID].Value(), extended); err != nil {
+			return fmt.Errorf("RTR reply: %w", err)
 		}
 	}
 
-	return form{inputs: inputs, focused: -1}
+	dlc, _ := strconv.ParseUint(f.inputs[inputDLC].Value(), 10, 8)
+	if dlc > CANFD_MAX_DLEN {
+		return fmt.Errorf("DLC %d is larger than %d", dlc, CANFD_MAX_DLEN)
+	}
+	cycle, _ := time.ParseDuration(f.inputs[inputCycle].Value() + "ms")
+
+	fd := f.toggles[toggleFD]
+	frame := Frame{ID: id, Length: uint8(dlc), IsExtended: extended, IsRemote: f.toggles[toggleRemote], IsFD: fd, BRS: fd && f.toggles[toggleBRS], ESI: fd && f.toggles[toggleESI]}
+	if err := frame.Validate(); err != nil {
+		return err
+	}
+
+	if err := f.signalError(); err != nil {
+		return err
+	}
+
+	// Remote frames carry no data, the DLC is the requested length
+	var data []byte
+	if !f.toggles[toggleRemote] {
+		data = make([]byte, dlc)
+		for i := 0; i < int(dlc); i++ {
+			b, _ := hex.DecodeString(f.inputs[inputData+i].Value())
+			if len(b) > 0 {
+				data[i] = b[0]
+			}
+		}
+	}
+
+	msg.Channel = channel
+	msg.ID = id
+	msg.Extended = extended
+	msg.Remote = frame.IsRemote
+	msg.FD = frame.IsFD
+	msg.BRS = frame.BRS
+	msg.ESI = frame.ESI
+	msg.DLC = uint8(dlc)
+	msg.CycleTime = cycle
+	msg.Data = data
+	msg.AutoReply = autoReply
+	msg.AutoReplyID = replyID
+	return nil
 }
 
 func updateForm(m Model, msg tea.Msg) (tea.Model, tea.Cmd) {
+	field := m.form.fields()[m.form.focused]
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "tab", "down":
-			m.form.inputs[m.form.focused].Blur()
-			m.form.focused = (m.form.focused + 1) % len(m.form.inputs)
-			m.form.inputs[m.form.focused].Focus()
+			m.form.setFocus((m.form.focused + 1) % len(m.form.fields()))
+			return m, nil
 		case "shift+tab", "up":
-			m.form.inputs[m.form.focused].Blur()
-			m.form.focused--
-			if m.form.focused < 0 {
-				m.form.focused = len(m.form.inputs) - 1
+			focused := m.form.focused - 1
+			if focused < 0 {
+				focused = len(m.form.fields()) - 1
 			}
-			m.form.inputs[m.form.focused].Focus()
-		case "enter":
-			id, _ := strconv.ParseUint(m.form.inputs[0].Value(), 16, 32)
-			dlc, _ := strconv.ParseUint(m.form.inputs[1].Value(), 10, 8)
-			cycle, _ := time.ParseDuration(m.form.inputs[2].Value() + "ms")
-			data := make([]byte, dlc)
-			for i := 0; i < int(dlc); i++ {
-				b, _ := hex.DecodeString(m.form.inputs[3+i].Value())
-				if len(b) > 0 {
-					data[i] = b[0]
-				}
+			m.form.setFocus(focused)
+			return m, nil
+		case " ", "x":
+			if field.toggle {
+				m.form.toggles[field.index] = !m.form.toggles[field.index]
+				m.form.syncSignals()
+				return m, nil
 			}
-
+		case "left", "right":
+			if field.signal && len(m.form.signalMsg.choices(m.form.signalMsg.Signals[field.index])) > 0 {
+				m.form.cycleChoice(field.index, msg.String() == "right")
+				m.form.encodeSignals()
+				m.form.refocus(field)
+				return m, nil
+			}
+		case "enter":
 			if m.form.editingUUID != "" {
 				// Update existing message
 				for i, msg := range m.sendMessages {
 					if msg.UUID.String() == m.form.editingUUID {
-						m.sendMessages[i].ID = uint32(id)
-						m.sendMessages[i].DLC = uint8(dlc)
-						m.sendMessages[i].CycleTime = cycle
-						m.sendMessages[i].Data = data
+						if err := m.form.parseMessage(m.sendMessages[i]); err != nil {
+							m.form.err = err.Error()
+							return m, nil
+						}
 						break
 					}
 				}
 				m.form.editingUUID = "" // Clear editing state
 			} else {
 				// Create new message
-				m.sendMessages = append(m.sendMessages, &SendMessage{UUID: uuid.New(), ID: uint32(id), DLC: uint8(dlc), CycleTime: cycle, Data: data, TriggerType: "", done: make(chan bool)})
+				newMsg := &SendMessage{UUID: uuid.New(), TriggerType: ""}
+				if err := m.form.parseMessage(newMsg); err != nil {
+					m.form.err = err.Error()
+					return m, nil
+				}
+				m.sendMessages = append(m.sendMessages, newMsg)
 			}
 			m.updateSendTable()
 			saveMessages(m.sendMessages)
@@ -114,28 +515,123 @@ func updateForm(m Model, msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
-	var cmds []tea.Cmd
-	for i := range m.form.inputs {
-		var c tea.Cmd
-		m.form.inputs[i], c = m.form.inputs[i].Update(msg)
-		cmds = append(cmds, c)
+	if field.toggle {
+		return m, nil
 	}
 
-	return m, tea.Batch(cmds...)
+	var cmd tea.Cmd
+	if field.signal {
+		m.form.signalInputs[field.index], cmd = m.form.signalInputs[field.index].Update(msg)
+		m.form.encodeSignals()
+		m.form.refocus(field) // Switching the multiplexer page changes the fields
+		return m, cmd
+	}
+	m.form.inputs[field.index], cmd = m.form.inputs[field.index].Update(msg)
+	switch field.index {
+	case inputID:
+		m.form.syncSignals()
+	case inputDLC:
+		m.form.encodeSignals()
+	}
+	return m, cmd
+}
+
+// toggleView renders a checkbox for the given toggle.
+func (f form) toggleView(index int) string {
+	box := "[ ]"
+	if f.toggles[index] {
+		box = "[x]"
+	}
+	if f.isFocused(formField{toggle: true, index: index}) {
+		return focusedToggleStyle.Render(box)
+	}
+	return box
 }
 
 func (f form) View(m Model) string {
 	var b strings.Builder
-	fmt.Fprintf(&b, "ID: 0x%s\n", f.inputs[0].View())
-	fmt.Fprintf(&b, "DLC: %s\n", f.inputs[1].View())
-	fmt.Fprintf(&b, "Cycle: %s ms\n", f.inputs[2].View())
+	fmt.Fprintf(&b, "Channel: %s\n", f.inputs[inputChannel].View())
+	fmt.Fprintf(&b, "ID: 0x%s\n", f.inputs[inputID].View())
+	fmt.Fprintf(&b, "Extended (29 bit): %s\n", f.toggleView(toggleExtended))
+	fmt.Fprintf(&b, "Remote request (RTR): %s\n", f.toggleView(toggleRemote))
+	fmt.Fprintf(&b, "CAN FD: %s", f.toggleView(toggleFD))
+	if f.toggles[toggleFD] {
+		fmt.Fprintf(&b, "  BRS: %s  ESI: %s", f.toggleView(toggleBRS), f.toggleView(toggleESI))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "DLC: %s\n", f.inputs[inputDLC].View())
+	fmt.Fprintf(&b, "Cycle: %s ms\n", f.inputs[inputCycle].View())
+	fmt.Fprintf(&b, "Reply to RTR of ID: 0x%s\n", f.inputs[inputReplyID].View())
+
+	if f.dbcMessage() != nil && !f.toggles[toggleRemote] {
+		fmt.Fprintf(&b, "Edit raw data bytes: %s\n", f.toggleView(toggleRawData))
+	}
 
-	dataFields := []string{}
-	for i := 3; i < 11; i++ {
-		dataFields = append(dataFields, f.inputs[i].View())
+	// Eight data bytes per line, read only while editing signals
+	data := f.dataBytes()
+	for row := 0; row < f.dataInputs(); row += 8 {
+		dataFields := []string{}
+		for i := row; i < min(row+8, f.dataInputs()); i++ {
+			if f.signalMsg != nil {
+				dataFields = append(dataFields, fmt.Sprintf("%02X ", data[i]))
+				continue
+			}
+			dataFields = append(dataFields, f.inputs[inputData+i].View())
+		}
+		label := "Data:"
+		if row > 0 {
+			label = fmt.Sprintf("  %02d:", row)
+		}
+		fmt.Fprintf(&b, "%s %s\n", label, strings.Join(dataFields, " "))
+	}
+
+	if f.signalMsg != nil {
+		b.WriteString(f.signalsView())
+	}
+
+	if f.err != "" {
+		fmt.Fprintf(&b, "\n%s\n", formErrorStyle.Render(f.err))
 	}
-	fmt.Fprintf(&b, "Data: %s\n", strings.Join(dataFields, " "))
 
 	popup := popupStyle.Render(b.String())
 	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
 }
+
+// signalsView renders the signal editor: one line per signal with its
+// input, unit and range or value table hint.
+func (f form) signalsView() string {
+	var b strings.Builder
+	active := f.activeSignals()
+	var switches []string
+	for _, i := range active {
+		if sig := f.signalMsg.Signals[i]; sig.MuxSwitch {
+			switches = append(switches, sig.Name+" = "+f.signalInputs[i].Value())
+		}
+	}
+	fmt.Fprintf(&b, "\nSignals of %s:\n", f.signalMsg.Name)
+	if len(switches) > 0 {
+		fmt.Fprintf(&b, "Multiplexer: %s\n", strings.Join(switches, ", "))
+	}
+	nameWidth := 0
+	for _, sig := range f.signalMsg.Signals {
+		nameWidth = max(nameWidth, len(sig.Name))
+	}
+	for _, i := range active {
+		sig := f.signalMsg.Signals[i]
+		hint := ""
+		switch {
+		case len(sig.Values) > 0:
+			hint = fmt.Sprintf("←/→: %d choices", len(sig.Values))
+		case sig.MuxSwitch && len(f.signalMsg.muxValues(sig)) > 0:
+			hint = fmt.Sprintf("←/→: %d pages", len(f.signalMsg.muxValues(sig)))
+		case sig.Min < sig.Max:
+			hint = fmt.Sprintf("%s … %s", sig.formatPhysical(sig.Min), sig.formatPhysical(sig.Max))
+		}
+		line := fmt.Sprintf("%-*s %s %-6s %s", nameWidth, sig.Name, f.signalInputs[i].View(), sig.Unit, hint)
+		if f.signalErrs[i] != "" {
+			line += " " + formErrorStyle.Render(f.signalErrs[i])
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
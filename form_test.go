@@ -0,0 +1,194 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// signalIndex returns the index of a signal in the signal editor of the form.
+func signalIndex(t *testing.T, f form, name string) int {
+	t.Helper()
+	for i, sig := range f.signalMsg.Signals {
+		if sig.Name == name {
+			return i
+		}
+	}
+	t.Fatalf("form has no signal %s", name)
+	return -1
+}
+
+// setSignal enters a value for a signal like typing into its input does.
+func setSignal(t *testing.T, f *form, name, value string) {
+	t.Helper()
+	f.signalInputs[signalIndex(t, *f, name)].SetValue(value)
+	f.encodeSignals()
+}
+
+// activeSignalNames returns the names of the signals shown in the editor.
+func activeSignalNames(f form) []string {
+	var names []string
+	for _, i := range f.activeSignals() {
+		names = append(names, f.signalMsg.Signals[i].Name)
+	}
+	return names
+}
+
+func TestFormSignalEditor(t *testing.T) {
+	useTestDBC(t, testDBC)
+	f := newForm(&SendMessage{ID: 0x123, DLC: 8, Data: testDBCData}, []string{"can0"})
+	if f.signalMsg == nil {
+		t.Fatal("signal editor not opened for a DBC message")
+	}
+	for name, value := range map[string]string{"Speed": "1374.0", "Temp": "-20", "Torque": "-50.00", "Gear": "Drive, sport"} {
+		if got := f.signalInputs[signalIndex(t, f, name)].Value(); got != value {
+			t.Errorf("%s starts at %q, want %q", name, got, value)
+		}
+	}
+	if !slices.Equal(f.dataBytes(), testDBCData) {
+		t.Errorf("opening the editor changed the data to % X", f.dataBytes())
+	}
+
+	// Motorola signal across the fourth and fifth byte, then a value table entry
+	setSignal(t, &f, "Torque", "125")
+	setSignal(t, &f, "Gear", "park")
+	want := []byte{0xC0, 0xAB, 0xEC, 0x1F, 0x40, 0x00, 0x80, 0x09}
+	if !slices.Equal(f.dataBytes(), want) {
+		t.Errorf("data = % X, want % X", f.dataBytes(), want)
+	}
+
+	// Invalid values keep their bits and block saving the message
+	setSignal(t, &f, "Speed", "3000")
+	if err := f.signalError(); err == nil || !strings.HasPrefix(err.Error(), "Speed: ") {
+		t.Errorf("signal error = %v, want an error of Speed", err)
+	}
+	if !slices.Equal(f.dataBytes(), want) {
+		t.Errorf("invalid value changed the data to % X", f.dataBytes())
+	}
+	var msg SendMessage
+	if err := f.parseMessage(&msg); err == nil {
+		t.Error("message with an invalid signal value saved")
+	}
+
+	setSignal(t, &f, "Speed", "0.5")
+	want[0], want[1] = 0x10, 0x00
+	if err := f.parseMessage(&msg); err != nil || !slices.Equal(msg.Data, want) {
+		t.Errorf("saved % X, %v, want % X", msg.Data, err, want)
+	}
+
+	// Signals outside of a shorter DLC can not be encoded
+	f.inputs[inputDLC].SetValue("4")
+	f.encodeSignals()
+	if err := f.signalError(); err == nil || !strings.Contains(err.Error(), "outside of the DLC 4") {
+		t.Errorf("signal error = %v, want the DLC to be too short", err)
+	}
+	f.inputs[inputDLC].SetValue("8")
+
+	// Raw data editing keeps the encoded bytes
+	f.toggles[toggleRawData] = true
+	f.syncSignals()
+	if f.signalMsg != nil || !slices.Equal(f.dataBytes(), want) {
+		t.Errorf("raw editing shows signals %v, data % X", f.signalMsg != nil, f.dataBytes())
+	}
+}
+
+func TestFormCycleChoice(t *testing.T) {
+	useTestDBC(t, testDBC)
+	f := newForm(&SendMessage{ID: 0x123, DLC: 8, Data: testDBCData}, nil)
+	gear := signalIndex(t, f, "Gear")
+	for _, step := range []struct {
+		forward bool
+		value   string
+	}{
+		{true, "Park"}, // Wraps around after the last entry
+		{true, "Reverse"},
+		{false, "Park"},
+		{false, "Drive, sport"},
+	} {
+		f.cycleChoice(gear, step.forward)
+		if got := f.signalInputs[gear].Value(); got != step.value {
+			t.Errorf("cycled to %q, want %q", got, step.value)
+		}
+	}
+	// Signals without choices keep their value
+	speed := signalIndex(t, f, "Speed")
+	f.cycleChoice(speed, true)
+	if got := f.signalInputs[speed].Value(); got != "1374.0" {
+		t.Errorf("Speed cycled to %q", got)
+	}
+}
+
+func TestFormMultiplexerPages(t *testing.T) {
+	useTestDBC(t, testMuxDBC)
+	f := newForm(&SendMessage{ID: 0x400, DLC: 4, Data: []byte{1, 0x11, 0x34, 0x12}}, nil)
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Mode", "Always", "PageA"}) {
+		t.Fatalf("active signals %v on page 1", got)
+	}
+	mode := signalIndex(t, f, "Mode")
+
+	// Page 2 writes PageB over the low byte of PageA and keeps its high byte
+	f.cycleChoice(mode, true)
+	f.encodeSignals()
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Mode", "Always", "PageB"}) {
+		t.Errorf("active signals %v on page 2", got)
+	}
+	if want := []byte{2, 0x11, 0x00, 0x12}; !slices.Equal(f.dataBytes()[:4], want) {
+		t.Errorf("page 2 data = % X, want % X", f.dataBytes()[:4], want)
+	}
+	setSignal(t, &f, "PageB", "255")
+
+	// Back on page 1 PageA still has its value
+	f.cycleChoice(mode, true)
+	f.encodeSignals()
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Mode", "Always", "PageA"}) {
+		t.Errorf("active signals %v back on page 1", got)
+	}
+	if want := []byte{1, 0x11, 0x34, 0x12}; !slices.Equal(f.dataBytes()[:4], want) {
+		t.Errorf("page 1 data = % X, want % X", f.dataBytes()[:4], want)
+	}
+	if got := f.signalInputs[signalIndex(t, f, "PageB")].Value(); got != "255" {
+		t.Errorf("PageB lost its value: %q", got)
+	}
+}
+
+func TestFormNestedMultiplexer(t *testing.T) {
+	useTestDBC(t, testMuxDBC)
+	f := newForm(&SendMessage{ID: 0x401, DLC: 4, Data: []byte{4, 16, 0xAA, 0xBB}}, nil)
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Service"}) {
+		t.Fatalf("active signals %v for service 4", got)
+	}
+
+	// Service 4 selects no signals, the first choice is service 1. Its
+	// Subfunction was inactive when the form opened and starts at 0.
+	service := signalIndex(t, f, "Service")
+	f.cycleChoice(service, true)
+	f.encodeSignals()
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Service", "Subfunction"}) {
+		t.Errorf("active signals %v for service 1", got)
+	}
+
+	subfunction := signalIndex(t, f, "Subfunction")
+	for _, want := range [][]string{
+		{"Service", "Subfunction", "Session"}, // Subfunction 16
+		{"Service", "Subfunction", "Key"},     // Subfunction 39
+	} {
+		f.cycleChoice(subfunction, true)
+		f.encodeSignals()
+		if got := activeSignalNames(f); !slices.Equal(got, want) {
+			t.Errorf("active signals %v, want %v", got, want)
+		}
+	}
+
+	// Another service hides the nested switch and its signals
+	setSignal(t, &f, "Service", "5")
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Service", "Dtc"}) {
+		t.Errorf("active signals %v for service 5", got)
+	}
+	setSignal(t, &f, "Service", "1")
+	if got := activeSignalNames(f); !slices.Equal(got, []string{"Service", "Subfunction", "Key"}) {
+		t.Errorf("active signals %v back on service 1", got)
+	}
+	if got := f.dataBytes()[:2]; !slices.Equal(got, []byte{1, 39}) {
+		t.Errorf("switch bytes = % X, want 01 27", got)
+	}
+}
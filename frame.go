@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.einride.tech/can"
+)
+
+// Payload sizes of classic CAN and CAN FD frames.
+const (
+	CAN_MAX_DLEN   = 8
+	CANFD_MAX_DLEN = 64
+)
+
+// Frame is a classic CAN or CAN FD frame.
+//
+// It mirrors can.Frame of go.einride.tech/can, which is limited to eight
+// data bytes, and adds the CAN FD flags.
+type Frame struct {
+	ID         uint32
+	Length     uint8 // Number of data bytes, the requested length for remote frames
+	Data       [CANFD_MAX_DLEN]byte
+	IsExtended bool // 29-bit identifier
+	IsRemote   bool // Remote transmission request, classic CAN only
+	IsFD       bool // CAN FD frame
+	BRS        bool // Bit rate switch, the data phase was sent at the data bitrate
+	ESI        bool // Error state indicator, the transmitter is error passive
+	IsError    bool // Error frame reported by the controller, ID holds the CAN_ERR_* class bits
+}
+
+// canFDLengths lists the payload lengths a CAN FD frame can carry, indexed
+// by the DLC code.
+var canFDLengths = [16]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+// fdLengthToDLC returns the DLC code of a CAN FD payload length, rounding
+// up to the next valid length.
+func fdLengthToDLC(length uint8) uint8 {
+	for dlc, l := range canFDLengths {
+		if l >= length {
+			return uint8(dlc)
+		}
+	}
+	return 15
+}
+
+// fdDLCToLength returns the payload length of a CAN FD DLC code.
+func fdDLCToLength(dlc uint8) uint8 {
+	return canFDLengths[dlc&0x0F]
+}
+
+// isValidFDLength reports whether a CAN FD frame can carry exactly length
+// bytes.
+func isValidFDLength(length uint8) bool {
+	return fdDLCToLength(fdLengthToDLC(length)) == length
+}
+
+// Payload returns the data bytes carried by the frame.
+func (f Frame) Payload() []byte {
+	if f.IsRemote {
+		return nil
+	}
+	return f.Data[:f.Length]
+}
+
+// DLC returns the data length code of the frame as sent on the wire.
+func (f Frame) DLC() uint8 {
+	if f.IsFD {
+		return fdLengthToDLC(f.Length)
+	}
+	return f.Length
+}
+
+// Validate returns an error if the frame can not be put on a bus.
+func (f Frame) Validate() error {
+	if f.IsError {
+		return fmt.Errorf("error frames can not be sent")
+	}
+	if f.IsExtended && f.ID > can.MaxExtendedID {
+		return fmt.Errorf("ID 0x%X does not fit in 29 bits", f.ID)
+	}
+	if !f.IsExtended && f.ID > can.MaxID {
+		return fmt.Errorf("ID 0x%X does not fit in 11 bits", f.ID)
+	}
+	if f.IsFD {
+		if f.IsRemote {
+			return fmt.Errorf("CAN FD has no remote frames")
+		}
+		if !isValidFDLength(f.Length) {
+			return fmt.Errorf("CAN FD length must be one of 0-8, 12, 16, 20, 24, 32, 48 or 64, not %d", f.Length)
+		}
+		return nil
+	}
+	if f.BRS || f.ESI {
+		return fmt.Errorf("BRS and ESI are only valid for CAN FD frames")
+	}
+	if f.Length > CAN_MAX_DLEN {
+		return fmt.Errorf("DLC %d is larger than %d", f.Length, CAN_MAX_DLEN)
+	}
+	return nil
+}
+
+// TypeString returns a short description of the frame type, e.g. "FD BRS".
+func (f Frame) TypeString() string {
+	switch {
+	case f.IsError:
+		return "ERR"
+	case f.IsRemote:
+		return "RTR"
+	case f.IsFD:
+		flags := []string{"FD"}
+		if f.BRS {
+			flags = append(flags, "BRS")
+		}
+		if f.ESI {
+			flags = append(flags, "ESI")
+		}
+		return strings.Join(flags, " ")
+	default:
+		return "CAN"
+	}
+}
+
+// String returns the frame in the candump(1) log format, e.g. "123#DEADBEEF"
+// or "12345678##1DEADBEEF" for a CAN FD frame with BRS set. Error frames
+// carry CAN_ERR_FLAG in their identifier.
+func (f Frame) String() string {
+	if f.IsError {
+		return fmt.Sprintf("%08X#%X", f.ID|CAN_ERR_FLAG, f.Payload())
+	}
+	var id string
+	if f.IsExtended {
+		id = fmt.Sprintf("%08X", f.ID)
+	} else {
+		id = fmt.Sprintf("%03X", f.ID)
+	}
+	switch {
+	case f.IsRemote && f.Length > 0:
+		return fmt.Sprintf("%s#R%d", id, f.Length)
+	case f.IsRemote:
+		return id + "#R"
+	case f.IsFD:
+		var flags uint8
+		if f.BRS {
+			flags |= 0x01
+		}
+		if f.ESI {
+			flags |= 0x02
+		}
+		return fmt.Sprintf("%s##%X%X", id, flags, f.Payload())
+	default:
+		return fmt.Sprintf("%s#%X", id, f.Payload())
+	}
+}
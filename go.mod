@@ -9,6 +9,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/vishvananda/netlink v1.3.1
 	go.einride.tech/can v0.14.0
+	golang.org/x/sys v0.34.0
 )
 
 require (
@@ -31,9 +32,7 @@ require (
 	github.com/vishvananda/netns v0.0.5 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/mod v0.26.0 // indirect
-	golang.org/x/net v0.42.0 // indirect
 	golang.org/x/sync v0.16.0 // indirect
-	golang.org/x/sys v0.34.0 // indirect
 	golang.org/x/text v0.27.0 // indirect
 	golang.org/x/tools v0.35.0 // indirect
 )
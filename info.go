@@ -3,238 +3,188 @@ package main
 import (
 	"fmt"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/vishvananda/netlink"
 )
 
-// SockaddrCan is a custom struct to mimic unix.RawSockaddrCan for Linux CAN sockets.
-type SockaddrCan struct {
-	Family  uint16
-	Ifindex int32
-	_       [4]byte // padding to align to 8 bytes
-}
+// defaultBitrate is used for the bus load estimate when the interface does
+// not report its bitrate.
+const defaultBitrate = 500000
 
-const (
-	CAN_MAX_DLEN       = 8
-	CAN_RAW_ERR_FILTER = 0x4
-	SOL_CAN_RAW        = 101
-	CAN_ERR_MASK       = 0x1FFF
-	CAN_ERR_FLAG       = 0x80000000
-	CAN_ERR_BUSOFF     = 0x00000080
-	CAN_ERR_CRTL       = 0x00000004
-	CAN_ERR_ACK        = 0x00000040
-	CAN_ERR_PROT       = 0x00000002
-	CAN_ERR_TRX        = 0x00000008
-	CAN_RAW            = 1 // This is a guess, might need to be adjusted
-)
+// maxErrorHistory is the number of error frames kept in the info panel.
+const maxErrorHistory = 10
 
 // info represents the CAN interface information panel.
+//
+// The panel does not open sockets of its own. Interface state and counters
+// are read via netlink, the bus load is derived from the frames the
+// application sees on its shared bus connection.
 type info struct {
-	interfaceName string
-	busStatus     string
-	busLoad       string
-	rxErrors      uint64
-	txErrors      uint64
-	canErrors     uint64
-
-	totalBytes     uint64
+	interfaceName   string
+	busStatus       string
+	busLoad         string
+	bitrate         uint32
+	rxErrors        uint64
+	txErrors        uint64
+	txErrorCounter  uint16
+	rxErrorCounter  uint16
+	errorFrames     uint64       // Number of error frames received
+	errorHistory    []CANMessage // Most recent error frames, oldest first
+	timestampSource string       // Source of the timestamps of the last received frame
+
+	frameBits      uint64
 	lastUpdateTime time.Time
-	stopChan       chan struct{}
 }
 
-func newInfo() info {
+func newInfo(interfaceName string) info {
 	return info{
-		interfaceName: "can0", // Default to can0 for now
-		stopChan:      make(chan struct{}),
+		interfaceName:  interfaceName,
+		busStatus:      "UNKNOWN",
+		lastUpdateTime: time.Now(),
 	}
 }
 
-// startBusLoadMonitor runs in a goroutine to calculate bus load.
-func (i *info) startBusLoadMonitor() {
-	link, err := netlink.LinkByName(i.interfaceName)
-	if err != nil {
-		// Log error or send to a channel for display
-		return
-	}
-
-	sock, err := syscall.Socket(syscall.AF_CAN, syscall.SOCK_RAW, CAN_RAW)
-	if err != nil {
-		// Log error
-		return
-	}
-	defer syscall.Close(sock)
-
-	ifIdx := link.Attrs().Index
-	err = syscall.Bind(sock, &syscall.SockaddrLinklayer{Ifindex: ifIdx, Protocol: CAN_RAW})
-	if err != nil {
-		// Log error
-		return
-	}
-
-	// Set a read deadline to avoid blocking indefinitely
-	tv := syscall.Timeval{Sec: 1}
-	err = syscall.SetsockoptTimeval(sock, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
-	if err != nil {
-		// Log error
-		return
-	}
-
-	i.totalBytes = 0
+// resetBusLoad starts a new bus load measurement interval.
+func (i *info) resetBusLoad() {
+	i.frameBits = 0
 	i.lastUpdateTime = time.Now()
+}
 
-	ticker := time.NewTicker(time.Second) // Update bus load every second
-	defer ticker.Stop()
-
-	const CAN_MAX_DLEN = 8
-
-	for {
-		select {
-		case <-i.stopChan:
-			return
-		case <-ticker.C:
-			// Calculate bus load
-			elapsed := time.Since(i.lastUpdateTime).Seconds()
-			if elapsed > 0 {
-				// Assuming 500 kbit/s for now (400,000 bits/s usable for data)
-				// This is a rough estimate, actual bus load calculation is complex
-				// and depends on bit stuffing, interframe spacing, etc.
-				busSpeedBitsPerSecond := 500000.0 // 500 kbit/s
-				// Approximate bits per frame (11-bit ID, 8 data bytes, plus overhead)
-				// A typical CAN frame with 8 data bytes is about 111 bits on the wire.
-				// Let's use a simplified calculation based on bytes for now.
-				// (totalBytes * 8 bits/byte) / (busSpeedBitsPerSecond * elapsed)
-				// For a more accurate calculation, we'd need to count actual frames and their overhead.
-				// For now, let's just use the received bytes as a proxy.
-				// A very rough estimate: 1 byte of data takes about 10-12 bits per byte due to overhead.
-				// Let's assume 10 bits per byte for a quick estimate.
-				load := (float64(i.totalBytes) * 10.0) / (busSpeedBitsPerSecond * elapsed)
-				i.busLoad = fmt.Sprintf("%.2f%%", load*100)
-			}
-			i.totalBytes = 0
-			i.lastUpdateTime = time.Now()
-		}
-
-		buf := make([]byte, CAN_MAX_DLEN+8) // CAN frame + can_id
-		n, _, err := syscall.Recvfrom(sock, buf, syscall.MSG_DONTWAIT) // Non-blocking read
-		if err != nil {
-			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
-				continue // No data, try again next tick
-			}
-			// Log error
-			continue
-		}
-
-		if n >= 8 { // Minimum size for a CAN frame (can_id + data_length_code)
-			// This is a received frame, add its data length to totalBytes
-			dlc := buf[4] & 0x0F // Data Length Code is in the 5th byte, lower 4 bits
-			i.totalBytes += uint64(dlc)
-		}
-	}
+// recordFrame accounts a frame seen on the bus for the bus load estimate.
+func (i *info) recordFrame(frame Frame) {
+	i.frameBits += frameBitLength(frame)
 }
 
-// updateInfo fetches the latest CAN interface information.
-func (i *info) updateInfo() error {
-	link, err := netlink.LinkByName(i.interfaceName)
-	if err != nil {
-		return fmt.Errorf("could not find interface %s: %w", i.interfaceName, err)
+// recordError adds an error frame to the error history. The controller
+// state and error counters it reports are shown until netlink provides
+// newer values.
+func (i *info) recordError(msg CANMessage) {
+	i.errorFrames++
+	i.errorHistory = append(i.errorHistory, msg)
+	if len(i.errorHistory) > maxErrorHistory {
+		i.errorHistory = i.errorHistory[len(i.errorHistory)-maxErrorHistory:]
 	}
 
-	// Get basic interface stats
-	if stats := link.Attrs().Statistics; stats != nil {
-		i.rxErrors = stats.RxErrors
-		i.txErrors = stats.TxErrors
+	canErr := decodeCANError(msg.Frame)
+	if state := canErr.ControllerState(); state != "" {
+		i.busStatus = state
 	}
-
-	// Open a raw CAN socket to receive error frames
-	sock, err := syscall.Socket(syscall.AF_CAN, syscall.SOCK_RAW, CAN_RAW)
-	if err != nil {
-		return fmt.Errorf("failed to open CAN socket: %w", err)
+	if canErr.HasCounters {
+		i.txErrorCounter = uint16(canErr.TxErrorCounter)
+		i.rxErrorCounter = uint16(canErr.RxErrorCounter)
 	}
-	defer syscall.Close(sock)
+}
 
-	// Bind the socket to the specific CAN interface
-	ifIdx := link.Attrs().Index
-	err = syscall.Bind(sock, &syscall.SockaddrLinklayer{Ifindex: ifIdx, Protocol: CAN_RAW})
-	if err != nil {
-		return fmt.Errorf("failed to bind CAN socket to %s: %w", i.interfaceName, err)
+// frameBitLength returns the nominal number of bits a frame occupies on the
+// wire including the interframe space. Bit stuffing is not accounted for and
+// the data phase of CAN FD frames is counted at the nominal bitrate, so FD
+// frames sent with BRS are overestimated.
+func frameBitLength(frame Frame) uint64 {
+	bits := uint64(47)
+	if frame.IsExtended {
+		bits = 67
 	}
-
-	// Set CAN_RAW_ERR_FILTER to receive error frames
-	errFilter := int(CAN_ERR_MASK)
-	err = syscall.SetsockoptInt(sock, SOL_CAN_RAW, CAN_RAW_ERR_FILTER, errFilter)
-	if err != nil {
-		return fmt.Errorf("failed to set error filter: %w", err)
+	if frame.IsFD {
+		// Longer CRC with stuff count, FDF, res, BRS and ESI bits
+		bits += 16
+		if frame.Length > 16 {
+			bits += 4
+		}
+	}
+	if !frame.IsRemote {
+		bits += uint64(frame.Length) * 8
 	}
+	return bits
+}
 
-	// Set a read deadline to avoid blocking indefinitely
-	tv := syscall.Timeval{Sec: 1}
-	err = syscall.SetsockoptTimeval(sock, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
-	if err != nil {
-		return fmt.Errorf("failed to set socket timeout: %w", err)
+// canStateString maps a netlink CAN controller state to a display string.
+func canStateString(state uint32) string {
+	switch state {
+	case netlink.CAN_STATE_ERROR_ACTIVE:
+		return "ERROR-ACTIVE"
+	case netlink.CAN_STATE_ERROR_WARNING:
+		return "ERROR-WARNING"
+	case netlink.CAN_STATE_ERROR_PASSIVE:
+		return "ERROR-PASSIVE"
+	case netlink.CAN_STATE_BUS_OFF:
+		return "BUS-OFF"
+	case netlink.CAN_STATE_STOPPED:
+		return "STOPPED"
+	case netlink.CAN_STATE_SLEEPING:
+		return "SLEEPING"
+	default:
+		return "UNKNOWN"
 	}
+}
 
-	// Read error frames
-	var canErrCount uint64
-	var busStatus string = "UNKNOWN"
-	for {
-		buf := make([]byte, CAN_MAX_DLEN+8) // CAN frame + can_id
-		n, _, err := syscall.Recvfrom(sock, buf, 0)
-		if err != nil {
-			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
-				break // Timeout, no more error frames for now
-			}
-			return fmt.Errorf("failed to read from CAN socket: %w", err)
-		}
+// updateInfo fetches the latest CAN interface information and closes the
+// current bus load interval.
+func (i *info) updateInfo() error {
+	bitrate := uint32(defaultBitrate)
 
-		if n < 8 { // Minimum size for a CAN frame (can_id + data_length_code)
-			continue
+	link, err := netlink.LinkByName(i.interfaceName)
+	if err == nil {
+		// Get basic interface stats
+		if stats := link.Attrs().Statistics; stats != nil {
+			i.rxErrors = stats.RxErrors
+			i.txErrors = stats.TxErrors
 		}
 
-		canID := (uint32(buf[0]) << 24) | (uint32(buf[1]) << 16) | (uint32(buf[2]) << 8) | uint32(buf[3])
-		if (canID & CAN_ERR_FLAG) != 0 { // Check for error frame flag
-			canErrClass := canID & CAN_ERR_MASK
-			canErrCount++
-
-			switch canErrClass {
-			case CAN_ERR_BUSOFF:
-				busStatus = "BUS-OFF"
-			case CAN_ERR_CRTL:
-				// Controller problems (e.g., error passive)
-				busStatus = "ERROR-PASSIVE"
-			case CAN_ERR_ACK:
-				// Acknowledge errors
-				busStatus = "ACK-ERROR"
-			case CAN_ERR_PROT:
-				// Protocol errors (e.g., bit error, stuff error)
-				busStatus = "PROTOCOL-ERROR"
-			case CAN_ERR_TRX:
-				// Transceiver errors
-				busStatus = "TRANSCEIVER-ERROR"
-			default:
-				busStatus = "ERROR"
+		i.busStatus = "UNKNOWN"
+		if canLink, ok := link.(*netlink.Can); ok {
+			i.busStatus = canStateString(canLink.State)
+			i.txErrorCounter = canLink.TxError
+			i.rxErrorCounter = canLink.RxError
+			if canLink.BitRate > 0 {
+				bitrate = canLink.BitRate
 			}
 		}
 	}
+	i.bitrate = bitrate
 
-	i.canErrors = canErrCount
-	i.busStatus = busStatus
+	// Calculate bus load
+	elapsed := time.Since(i.lastUpdateTime).Seconds()
+	if elapsed > 0 {
+		load := float64(i.frameBits) / (float64(bitrate) * elapsed)
+		i.busLoad = fmt.Sprintf("%.2f%%", load*100)
+	}
+	i.resetBusLoad()
 
+	if err != nil {
+		return fmt.Errorf("could not find interface %s: %w", i.interfaceName, err)
+	}
 	return nil
 }
 
-// View renders the info panel.
-func (i info) View(m Model) string {
+// View renders the information of one channel.
+func (i info) View() string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "CAN Interface: %s\n", i.interfaceName)
 	fmt.Fprintf(&b, "Bus Status:    %s\n", i.busStatus)
+	fmt.Fprintf(&b, "Bitrate:       %d bit/s\n", i.bitrate)
 	fmt.Fprintf(&b, "Bus Load:      %s\n", i.busLoad)
 	fmt.Fprintf(&b, "RX Errors:     %d\n", i.rxErrors)
 	fmt.Fprintf(&b, "TX Errors:     %d\n", i.txErrors)
-	fmt.Fprintf(&b, "CAN Errors:    %d\n", i.canErrors)
+	fmt.Fprintf(&b, "TEC / REC:     %d / %d\n", i.txErrorCounter, i.rxErrorCounter)
+	fmt.Fprintf(&b, "Timestamps:    %s\n", i.timestampSource)
+	fmt.Fprintf(&b, "Error Frames:  %d\n", i.errorFrames)
+	if len(i.errorHistory) > 0 {
+		b.WriteString("\nRecent Errors:\n")
+		for _, msg := range i.errorHistory {
+			fmt.Fprintf(&b, "%s %s\n", msg.Timestamp.Format("15:04:05.000"), decodeCANError(msg.Frame))
+		}
+	}
+	return b.String()
+}
 
-	popup := popupStyle.Render(b.String())
+// renderInfoView renders the info panels of all channels in one popup.
+func (m Model) renderInfoView() string {
+	panels := make([]string, len(m.infoPanels))
+	for i, panel := range m.infoPanels {
+		panels[i] = panel.View()
+	}
+	popup := popupStyle.Render(strings.Join(panels, "\n"))
 	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
-}
\ No newline at end of file
+}
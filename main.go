@@ -1,17 +1,58 @@
-
-
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"os"
+	"strings"
+
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
-	canInterface := flag.String("d", "can0", "CAN interface to use")
+	canInterfaces := flag.String("d", "can0", "CAN interfaces to use, separated by commas")
+	recordFormat := flag.String("rec", "log", "Format of recordings: log (candump), asc (Vector), trc (PEAK), pcapng (Wireshark), mf4 (MDF 4) or csv")
+	csvColumnList := flag.String("csv", defaultCSVColumns, "Columns of CSV exports and recordings: "+strings.Join(csvColumnNames, ","))
+	var dbcFiles stringList
+	flag.Var(&dbcFiles, "dbc", "DBC file to decode signals with, may be given several times")
 	flag.Parse()
 
-	go listenForCANCtrl(*canInterface)
+	if _, ok := traceWriters[*recordFormat]; !ok {
+		fmt.Fprintf(os.Stderr, "nerdcan: unknown recording format '%s'\n", *recordFormat)
+		os.Exit(2)
+	}
+	columns, err := parseCSVColumns(*csvColumnList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nerdcan: %v\n", err)
+		os.Exit(2)
+	}
+	csvColumns = columns
+	if len(dbcFiles) > 0 {
+		signalDB, err = loadDBC(dbcFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "nerdcan: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	buses, err := newBuses(*canInterfaces)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nerdcan: %v\n", err)
+		os.Exit(2)
+	}
+
+	for _, bus := range buses {
+		if err := bus.Open(context.Background()); err != nil {
+			// Never started, its receive channel would never be closed
+			Log(ERROR, "Failed to open CAN interface '%s': %v", bus.Name(), err)
+			continue
+		}
+		Log(INFO, "Successfully opened CAN interface '%s'", bus.Name())
+		defer bus.Close()
+
+		go listenForCANCtrl(bus)
+	}
 
 	Log(INFO, "NerdCAN started successfully")
 
@@ -20,8 +61,25 @@ func main() {
 		Log(ERROR, "Error loading messages: %v", err)
 	}
 
-	p := tea.NewProgram(initialModel(messages, *canInterface), tea.WithAltScreen(), tea.WithMouseAllMotion())
+	watches, err := loadWatches()
+	if err != nil {
+		Log(ERROR, "Error loading watch list: %v", err)
+	}
+
+	p := tea.NewProgram(initialModel(messages, watches, buses, *recordFormat), tea.WithAltScreen(), tea.WithMouseAllMotion())
 	if err := p.Start(); err != nil {
-		Log(CRISIS, "main.p.Start", "Alas, there's been an error: %v", err)
+		Log(CRISIS, "Alas, there's been an error: %v", err)
 	}
 }
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
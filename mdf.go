@@ -0,0 +1,839 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MDF 4 channel, channel group and source constants used for CAN bus
+// logging as defined by the ASAM MDF bus logging standard.
+const (
+	mdfChannelVLSD   = 1 // cn_type: variable length data in an SD block
+	mdfChannelMaster = 2 // cn_type: master channel, e.g. the time
+
+	mdfSyncTime = 1 // cn_sync_type: the master channel is the time
+
+	mdfUintBE      = 1  // cn_data_type
+	mdfFloatLE     = 4  // cn_data_type
+	mdfByteArray   = 10 // cn_data_type
+	mdfFlagBusEvt  = 0x400
+	mdfCGBusEvent  = 0x02 // cg_flags: the group contains bus events
+	mdfCGPlainBus  = 0x04 // cg_flags: plain bus events without signal channels
+	mdfCGVLSD      = 0x01 // cg_flags: variable length records
+	mdfSourceBus   = 2    // si_type
+	mdfBusTypeCAN  = 2    // si_bus_type
+	mdfBlockHeader = 24   // id, reserved, length and link count
+)
+
+// Layout of the CAN_DataFrame records written by mdfWriter.
+const (
+	mdfRecordSize       = 79
+	mdfOffsetBusChannel = 8  // uint8
+	mdfOffsetID         = 9  // ID in bits 0-28, IDE in bit 31
+	mdfOffsetFlags      = 13 // DLC in bits 0-3, Dir, EDL, BRS and ESI in bits 4-7
+	mdfOffsetDataLength = 14 // uint8
+	mdfOffsetDataBytes  = 15 // 64 bytes
+)
+
+// mdfUnfinalized flags ask readers to update the cycle counters and the
+// length of the last DT block, which are only known once recording stops.
+const mdfUnfinalized = 0x01 | 0x04
+
+// mdfBlock is a block of an MDF 4 file under construction. Links point to
+// other blocks and are resolved to file offsets when the blocks are laid
+// out.
+type mdfBlock struct {
+	id     string
+	links  []*mdfBlock
+	data   []byte
+	offset int64
+}
+
+// size returns the length of the block, padded to 8 bytes.
+func (b *mdfBlock) size() int64 {
+	size := int64(mdfBlockHeader + 8*len(b.links) + len(b.data))
+	return (size + 7) &^ 7
+}
+
+func (b *mdfBlock) encode() []byte {
+	size := b.size()
+	out := make([]byte, 0, size)
+	out = append(out, "##"+b.id...)
+	out = append(out, 0, 0, 0, 0)
+	out = binary.LittleEndian.AppendUint64(out, uint64(size))
+	out = binary.LittleEndian.AppendUint64(out, uint64(len(b.links)))
+	for _, link := range b.links {
+		var offset int64
+		if link != nil {
+			offset = link.offset
+		}
+		out = binary.LittleEndian.AppendUint64(out, uint64(offset))
+	}
+	out = append(out, b.data...)
+	return append(out, make([]byte, size-int64(len(out)))...)
+}
+
+// mdfText returns a TX block with a zero terminated text.
+func mdfText(text string) *mdfBlock {
+	return &mdfBlock{id: "TX", data: append([]byte(text), 0)}
+}
+
+// mdfChannel describes a channel of the CAN_DataFrame record.
+type mdfChannel struct {
+	name       string
+	cnType     uint8
+	syncType   uint8
+	dataType   uint8
+	byteOffset uint32
+	bitOffset  uint8
+	bitCount   uint32
+	flags      uint32
+}
+
+// block returns the CN block of the channel.
+func (c mdfChannel) block(unit *mdfBlock) *mdfBlock {
+	data := []byte{c.cnType, c.syncType, c.dataType, c.bitOffset}
+	data = binary.LittleEndian.AppendUint32(data, c.byteOffset)
+	data = binary.LittleEndian.AppendUint32(data, c.bitCount)
+	data = binary.LittleEndian.AppendUint32(data, c.flags)
+	data = binary.LittleEndian.AppendUint32(data, 0) // Invalidation bit position
+	data = append(data, 0, 0, 0, 0)                  // Precision, reserved, attachment count
+	data = append(data, make([]byte, 6*8)...)        // Value ranges and limits
+	// cn_cn_next, cn_composition, cn_tx_name, cn_si_source, cn_cc_conversion,
+	// cn_data, cn_md_unit, cn_md_comment
+	return &mdfBlock{id: "CN", links: []*mdfBlock{nil, nil, mdfText(c.name), nil, nil, nil, unit, nil}, data: data}
+}
+
+// mdfWriter writes data frames as MDF 4.1 bus logging file with one
+// CAN_DataFrame channel group. Remote and error frames are not recorded.
+//
+// The file is written as unfinalized MDF while recording and finalized on
+// Close when the underlying writer supports io.WriterAt, as files do.
+type mdfWriter struct {
+	file     io.Writer
+	w        *bufio.Writer
+	channels map[string]uint8
+	start    time.Time
+	records  uint64
+	dt       *mdfBlock
+	cg       *mdfBlock
+	started  bool
+}
+
+func newMDFWriter(w io.Writer) traceWriter {
+	return &mdfWriter{file: w, w: bufio.NewWriter(w), channels: make(map[string]uint8)}
+}
+
+// writeHeader writes all blocks except the records, which follow the header
+// of the DT block.
+func (m *mdfWriter) writeHeader(start time.Time) error {
+	m.started = true
+	m.start = start
+
+	unit := mdfText("s")
+	master := mdfChannel{name: "Timestamp", cnType: mdfChannelMaster, syncType: mdfSyncTime, dataType: mdfFloatLE, bitCount: 64, flags: 0x800}.block(unit)
+	frame := mdfChannel{name: "CAN_DataFrame", dataType: mdfByteArray, byteOffset: mdfOffsetBusChannel, bitCount: (mdfRecordSize - mdfOffsetBusChannel) * 8, flags: mdfFlagBusEvt}.block(nil)
+	children := []mdfChannel{
+		{name: "CAN_DataFrame.BusChannel", byteOffset: mdfOffsetBusChannel, bitCount: 8},
+		{name: "CAN_DataFrame.ID", byteOffset: mdfOffsetID, bitCount: 29},
+		{name: "CAN_DataFrame.IDE", byteOffset: mdfOffsetID + 3, bitOffset: 7, bitCount: 1},
+		{name: "CAN_DataFrame.DLC", byteOffset: mdfOffsetFlags, bitCount: 4},
+		{name: "CAN_DataFrame.Dir", byteOffset: mdfOffsetFlags, bitOffset: 4, bitCount: 1},
+		{name: "CAN_DataFrame.EDL", byteOffset: mdfOffsetFlags, bitOffset: 5, bitCount: 1},
+		{name: "CAN_DataFrame.BRS", byteOffset: mdfOffsetFlags, bitOffset: 6, bitCount: 1},
+		{name: "CAN_DataFrame.ESI", byteOffset: mdfOffsetFlags, bitOffset: 7, bitCount: 1},
+		{name: "CAN_DataFrame.DataLength", byteOffset: mdfOffsetDataLength, bitCount: 8},
+		{name: "CAN_DataFrame.DataBytes", dataType: mdfByteArray, byteOffset: mdfOffsetDataBytes, bitCount: CANFD_MAX_DLEN * 8},
+	}
+	var previous *mdfBlock
+	for _, child := range children {
+		child.flags = mdfFlagBusEvt
+		cn := child.block(nil)
+		if previous == nil {
+			frame.links[1] = cn // cn_composition
+		} else {
+			previous.links[0] = cn
+		}
+		previous = cn
+	}
+	master.links[0] = frame
+
+	si := &mdfBlock{id: "SI", links: []*mdfBlock{mdfText("CAN"), mdfText("NerdCAN"), nil}, data: []byte{mdfSourceBus, mdfBusTypeCAN, 0, 0, 0, 0, 0, 0}}
+
+	cgData := binary.LittleEndian.AppendUint64(nil, 0)   // Record ID
+	cgData = binary.LittleEndian.AppendUint64(cgData, 0) // Cycle count, updated on Close
+	cgData = binary.LittleEndian.AppendUint16(cgData, mdfCGBusEvent|mdfCGPlainBus)
+	cgData = binary.LittleEndian.AppendUint16(cgData, '.') // Path separator
+	cgData = append(cgData, 0, 0, 0, 0)
+	cgData = binary.LittleEndian.AppendUint32(cgData, mdfRecordSize)
+	cgData = binary.LittleEndian.AppendUint32(cgData, 0) // Invalidation bytes
+	m.cg = &mdfBlock{id: "CG", links: []*mdfBlock{nil, master, mdfText("CAN_DataFrame"), si, nil, nil}, data: cgData}
+
+	m.dt = &mdfBlock{id: "DT"}
+	dg := &mdfBlock{id: "DG", links: []*mdfBlock{nil, m.cg, m.dt, nil}, data: make([]byte, 8)}
+
+	comment := &mdfBlock{id: "MD", data: []byte("<FHcomment>\n<TX>Recorded by NerdCAN</TX>\n<tool_id>NerdCAN</tool_id>\n<tool_vendor>NerdCAN</tool_vendor>\n<tool_version>1.0</tool_version>\n</FHcomment>\x00")}
+	fhData := binary.LittleEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+	fhData = append(fhData, 0, 0, 0, 0, 0, 0, 0, 0) // Time zone, DST, time flags, reserved
+	fh := &mdfBlock{id: "FH", links: []*mdfBlock{nil, comment}, data: fhData}
+
+	hdData := binary.LittleEndian.AppendUint64(nil, uint64(start.UnixNano()))
+	hdData = append(hdData, make([]byte, 24)...) // Time zone, DST, flags, start angle and distance
+	hd := &mdfBlock{id: "HD", links: []*mdfBlock{dg, fh, nil, nil, nil, nil}, data: hdData}
+
+	// Lay out the blocks after the 64 byte identification block, the DT
+	// block comes last so records can be appended
+	blocks := []*mdfBlock{hd, fh, comment, dg, m.cg, si, si.links[0], si.links[1], m.cg.links[2], master, unit, master.links[2], frame, frame.links[2]}
+	for cn := frame.links[1]; cn != nil; cn = cn.links[0] {
+		blocks = append(blocks, cn, cn.links[2])
+	}
+	blocks = append(blocks, m.dt)
+	offset := int64(64)
+	for _, block := range blocks {
+		block.offset = offset
+		offset += block.size()
+	}
+
+	id := make([]byte, 64)
+	copy(id[0:], "UnFinMF ")
+	copy(id[8:], "4.10    ")
+	copy(id[16:], "NerdCAN ")
+	binary.LittleEndian.PutUint16(id[28:], 410)
+	binary.LittleEndian.PutUint16(id[60:], mdfUnfinalized)
+	if _, err := m.w.Write(id); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if _, err := m.w.Write(block.encode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// channel returns the bus channel number of a channel name.
+func (m *mdfWriter) channel(name string) uint8 {
+	n, ok := m.channels[name]
+	if !ok {
+		n = uint8(len(m.channels) + 1)
+		m.channels[name] = n
+	}
+	return n
+}
+
+func (m *mdfWriter) WriteMessage(msg CANMessage) error {
+	if !m.started {
+		if err := m.writeHeader(msg.Timestamp); err != nil {
+			return err
+		}
+	}
+	frame := msg.Frame
+	if frame.IsError || frame.IsRemote {
+		return nil
+	}
+
+	record := make([]byte, mdfRecordSize)
+	binary.LittleEndian.PutUint64(record[0:], math.Float64bits(msg.Timestamp.Sub(m.start).Seconds()))
+	record[mdfOffsetBusChannel] = m.channel(msg.Channel)
+	id := frame.ID
+	if frame.IsExtended {
+		id |= 1 << 31
+	}
+	binary.LittleEndian.PutUint32(record[mdfOffsetID:], id)
+	flags := frame.DLC() & 0x0F
+	if msg.Direction == "TX" {
+		flags |= 0x10
+	}
+	if frame.IsFD {
+		flags |= 0x20
+	}
+	if frame.BRS {
+		flags |= 0x40
+	}
+	if frame.ESI {
+		flags |= 0x80
+	}
+	record[mdfOffsetFlags] = flags
+	record[mdfOffsetDataLength] = frame.Length
+	copy(record[mdfOffsetDataBytes:], frame.Payload())
+	if _, err := m.w.Write(record); err != nil {
+		return err
+	}
+	m.records++
+	return nil
+}
+
+// Close writes the buffered records and finalizes the file: the length of
+// the DT block, the cycle count of the channel group and the identification
+// are updated in place.
+func (m *mdfWriter) Close() error {
+	if !m.started {
+		if err := m.writeHeader(time.Now()); err != nil {
+			return err
+		}
+	}
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+	file, ok := m.file.(io.WriterAt)
+	if !ok {
+		return nil // Stays unfinalized
+	}
+	length := binary.LittleEndian.AppendUint64(nil, mdfBlockHeader+m.records*mdfRecordSize)
+	if _, err := file.WriteAt(length, m.dt.offset+8); err != nil {
+		return err
+	}
+	count := binary.LittleEndian.AppendUint64(nil, m.records)
+	if _, err := file.WriteAt(count, m.cg.offset+mdfBlockHeader+8*int64(len(m.cg.links))+8); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt([]byte("MDF     "), 0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt([]byte{0, 0}, 60)
+	return err
+}
+
+// mdfRawBlock is a block read from an MDF 4 file.
+type mdfRawBlock struct {
+	id     string
+	length uint64
+	links  []int64
+	data   []byte
+}
+
+// link returns link i, or 0 if the block has fewer links.
+func (b *mdfRawBlock) link(i int) int64 {
+	if i < len(b.links) {
+		return b.links[i]
+	}
+	return 0
+}
+
+// mdfSignal is a channel of a CAN_DataFrame record.
+type mdfSignal struct {
+	cnType     uint8
+	dataType   uint8
+	byteOffset int
+	bitOffset  int
+	bitCount   int
+	a0, a1     float64 // Linear conversion to the physical value
+	sd         []byte  // Signal data of VLSD channels
+}
+
+// raw returns the integer value of the signal in record.
+func (s *mdfSignal) raw(record []byte) uint64 {
+	n := (s.bitOffset + s.bitCount + 7) / 8
+	if s.byteOffset+n > len(record) || n > 8 {
+		return 0
+	}
+	var b [8]byte
+	var value uint64
+	if s.dataType == mdfUintBE {
+		copy(b[8-n:], record[s.byteOffset:s.byteOffset+n])
+		value = binary.BigEndian.Uint64(b[:]) >> s.bitOffset
+	} else {
+		copy(b[:], record[s.byteOffset:s.byteOffset+n])
+		value = binary.LittleEndian.Uint64(b[:]) >> s.bitOffset
+	}
+	if s.bitCount < 64 {
+		value &= 1<<s.bitCount - 1
+	}
+	return value
+}
+
+// value returns the physical value of a numeric signal in record.
+func (s *mdfSignal) value(record []byte) float64 {
+	var v float64
+	if s.dataType == mdfFloatLE && s.bitCount == 64 {
+		v = math.Float64frombits(s.raw(record))
+	} else if s.dataType == mdfFloatLE && s.bitCount == 32 {
+		v = float64(math.Float32frombits(uint32(s.raw(record))))
+	} else {
+		v = float64(s.raw(record))
+	}
+	return s.a0 + s.a1*v
+}
+
+// bytes returns the content of a byte array signal in record.
+func (s *mdfSignal) bytes(record []byte) []byte {
+	if s.cnType == mdfChannelVLSD {
+		offset := s.raw(record)
+		if offset+4 > uint64(len(s.sd)) {
+			return nil
+		}
+		length := uint64(binary.LittleEndian.Uint32(s.sd[offset:]))
+		return s.sd[offset+4 : min(offset+4+length, uint64(len(s.sd)))]
+	}
+	end := min(s.byteOffset+s.bitCount/8, len(record))
+	if s.byteOffset > end {
+		return nil
+	}
+	return record[s.byteOffset:end]
+}
+
+// mdfGroup is a channel group of a data group.
+type mdfGroup struct {
+	size    int  // Record size without record ID
+	vlsd    bool // Records are a length followed by that many bytes
+	signals map[string]*mdfSignal
+}
+
+// mdfStream reads the records of one data group.
+type mdfStream struct {
+	data      io.Reader
+	idSize    int
+	groups    map[uint64]*mdfGroup
+	next      *CANMessage
+	exhausted bool
+}
+
+// mdfReader reads the CAN_DataFrame channel groups of MDF 4 bus logging
+// files. Frames of all data groups are returned in time order.
+type mdfReader struct {
+	source      io.Reader
+	r           io.ReaderAt
+	unfinalized bool // The length of the last DT block was not updated
+	start       time.Time
+	streams     []*mdfStream
+	opened      bool
+	err         error
+}
+
+func newMDFReader(r io.Reader) traceReader {
+	return &mdfReader{source: r}
+}
+
+// readBlock reads the block at offset, expecting the given block id.
+func (m *mdfReader) readBlock(offset int64, id string) (*mdfRawBlock, error) {
+	header := make([]byte, mdfBlockHeader)
+	if _, err := m.r.ReadAt(header, offset); err != nil {
+		return nil, fmt.Errorf("reading block at %d: %w", offset, err)
+	}
+	b := &mdfRawBlock{id: string(header[2:4]), length: binary.LittleEndian.Uint64(header[8:16])}
+	if string(header[0:2]) != "##" || (id != "" && b.id != id) {
+		return nil, fmt.Errorf("expected %s block at %d, found '%s'", id, offset, header[0:4])
+	}
+	linkCount := binary.LittleEndian.Uint64(header[16:24])
+	if b.length < mdfBlockHeader+8*linkCount || b.length > 1<<30 {
+		return nil, fmt.Errorf("invalid %s block at %d", b.id, offset)
+	}
+	body := make([]byte, b.length-mdfBlockHeader)
+	if _, err := m.r.ReadAt(body, offset+mdfBlockHeader); err != nil {
+		return nil, fmt.Errorf("reading %s block at %d: %w", b.id, offset, err)
+	}
+	for i := uint64(0); i < linkCount; i++ {
+		b.links = append(b.links, int64(binary.LittleEndian.Uint64(body[8*i:])))
+	}
+	b.data = body[8*linkCount:]
+	return b, nil
+}
+
+// readText returns the text of a TX or MD block, or "" for link 0.
+func (m *mdfReader) readText(offset int64) string {
+	if offset == 0 {
+		return ""
+	}
+	b, err := m.readBlock(offset, "")
+	if err != nil {
+		return ""
+	}
+	text, _, _ := strings.Cut(string(b.data), "\x00")
+	return text
+}
+
+// open reads the structure of the file.
+func (m *mdfReader) open() error {
+	if r, ok := m.source.(io.ReaderAt); ok {
+		m.r = r
+	} else {
+		data, err := io.ReadAll(m.source)
+		if err != nil {
+			return err
+		}
+		m.r = bytes.NewReader(data)
+	}
+
+	id := make([]byte, 64)
+	if _, err := m.r.ReadAt(id, 0); err != nil {
+		return errors.New("not an MDF file")
+	}
+	if !bytes.HasPrefix(id, []byte("MDF ")) && !bytes.HasPrefix(id, []byte("UnFinMF ")) {
+		return errors.New("not an MDF file")
+	}
+	if version := binary.LittleEndian.Uint16(id[28:30]); version < 400 {
+		return fmt.Errorf("unsupported MDF version %d, only MDF 4 is supported", version)
+	}
+	m.unfinalized = bytes.HasPrefix(id, []byte("UnFinMF ")) && binary.LittleEndian.Uint16(id[60:62])&0x04 != 0
+
+	hd, err := m.readBlock(64, "HD")
+	if err != nil {
+		return err
+	}
+	if len(hd.data) < 8 {
+		return errors.New("invalid HD block")
+	}
+	m.start = time.Unix(0, int64(binary.LittleEndian.Uint64(hd.data[0:8])))
+
+	for offset := hd.link(0); offset != 0; {
+		dg, err := m.readBlock(offset, "DG")
+		if err != nil {
+			return err
+		}
+		stream, err := m.openDataGroup(dg)
+		if err != nil {
+			return err
+		}
+		if stream != nil {
+			m.streams = append(m.streams, stream)
+		}
+		offset = dg.link(0)
+	}
+	if len(m.streams) == 0 {
+		return errors.New("no CAN_DataFrame channel group found")
+	}
+	return nil
+}
+
+// openDataGroup reads the channel groups of a data group. It returns nil if
+// the group contains no CAN data frames.
+func (m *mdfReader) openDataGroup(dg *mdfRawBlock) (*mdfStream, error) {
+	if len(dg.data) < 1 {
+		return nil, errors.New("invalid DG block")
+	}
+	stream := &mdfStream{idSize: int(dg.data[0]), groups: make(map[uint64]*mdfGroup)}
+	found := false
+	for offset := dg.link(1); offset != 0; {
+		cg, err := m.readBlock(offset, "CG")
+		if err != nil {
+			return nil, err
+		}
+		if len(cg.data) < 32 {
+			return nil, errors.New("invalid CG block")
+		}
+		recordID := binary.LittleEndian.Uint64(cg.data[0:8])
+		flags := binary.LittleEndian.Uint16(cg.data[16:18])
+		group := &mdfGroup{
+			size: int(binary.LittleEndian.Uint32(cg.data[24:28]) + binary.LittleEndian.Uint32(cg.data[28:32])),
+			vlsd: flags&mdfCGVLSD != 0,
+		}
+		if !group.vlsd && m.readText(cg.link(2)) == "CAN_DataFrame" {
+			group.signals = make(map[string]*mdfSignal)
+			if err := m.readChannels(cg.link(1), group.signals); err != nil {
+				return nil, err
+			}
+			if group.signals["Timestamp"] == nil || group.signals["ID"] == nil {
+				return nil, errors.New("CAN_DataFrame group without time or ID channel")
+			}
+			found = true
+		}
+		stream.groups[recordID] = group
+		offset = cg.link(0)
+	}
+	if !found {
+		return nil, nil
+	}
+	data, err := m.dataReader(dg.link(2))
+	if err != nil {
+		return nil, err
+	}
+	stream.data = bufio.NewReader(data)
+	return stream, nil
+}
+
+// readChannels reads a list of channels including the channels they are
+// composed of. Signals are stored by the last part of their name, e.g. "ID"
+// for "CAN_DataFrame.ID", and the master channel as "Timestamp".
+func (m *mdfReader) readChannels(offset int64, signals map[string]*mdfSignal) error {
+	for offset != 0 {
+		cn, err := m.readBlock(offset, "CN")
+		if err != nil {
+			return err
+		}
+		if len(cn.data) < 16 {
+			return errors.New("invalid CN block")
+		}
+		signal := &mdfSignal{
+			cnType:     cn.data[0],
+			dataType:   cn.data[2],
+			bitOffset:  int(cn.data[3]),
+			byteOffset: int(binary.LittleEndian.Uint32(cn.data[4:8])),
+			bitCount:   int(binary.LittleEndian.Uint32(cn.data[8:12])),
+			a1:         1,
+		}
+		if err := m.readConversion(cn.link(4), signal); err != nil {
+			return err
+		}
+		name := m.readText(cn.link(2))
+		if signal.cnType == mdfChannelMaster && cn.data[1] == mdfSyncTime {
+			name = "Timestamp"
+		} else if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		if signal.cnType == mdfChannelVLSD && cn.link(5) != 0 {
+			sd, err := m.readSignalData(cn.link(5))
+			if err != nil {
+				return err
+			}
+			signal.sd = sd
+		}
+		signals[name] = signal
+
+		if composition := cn.link(1); composition != 0 {
+			if err := m.readChannels(composition, signals); err != nil {
+				return err
+			}
+		}
+		offset = cn.link(0)
+	}
+	return nil
+}
+
+// readConversion reads an identity or linear conversion.
+func (m *mdfReader) readConversion(offset int64, signal *mdfSignal) error {
+	if offset == 0 {
+		return nil
+	}
+	cc, err := m.readBlock(offset, "CC")
+	if err != nil {
+		return err
+	}
+	if len(cc.data) < 24 {
+		return errors.New("invalid CC block")
+	}
+	switch cc.data[0] {
+	case 0: // Identity
+	case 1: // Linear
+		if len(cc.data) < 40 {
+			return errors.New("invalid linear conversion")
+		}
+		signal.a0 = math.Float64frombits(binary.LittleEndian.Uint64(cc.data[24:32]))
+		signal.a1 = math.Float64frombits(binary.LittleEndian.Uint64(cc.data[32:40]))
+	default:
+		return fmt.Errorf("unsupported conversion type %d", cc.data[0])
+	}
+	return nil
+}
+
+// readSignalData reads the signal data of a VLSD channel.
+func (m *mdfReader) readSignalData(offset int64) ([]byte, error) {
+	data, err := m.dataReader(offset)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(data)
+}
+
+// dataReader returns a reader for the content of a data block: a DT or SD
+// block, a DZ block with zipped data or a list of them.
+func (m *mdfReader) dataReader(offset int64) (io.Reader, error) {
+	if offset == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	header := make([]byte, mdfBlockHeader)
+	if _, err := m.r.ReadAt(header, offset); err != nil {
+		return nil, fmt.Errorf("reading block at %d: %w", offset, err)
+	}
+	switch string(header[0:4]) {
+	case "##DT", "##SD", "##RD":
+		// Data blocks have no links and are read on demand
+		length := int64(binary.LittleEndian.Uint64(header[8:16])) - mdfBlockHeader
+		if m.unfinalized && string(header[0:4]) == "##DT" {
+			length = math.MaxInt64 - offset - mdfBlockHeader // Up to the end of the file
+		}
+		return io.NewSectionReader(m.r, offset+mdfBlockHeader, length), nil
+	}
+
+	b, err := m.readBlock(offset, "")
+	if err != nil {
+		return nil, err
+	}
+	switch b.id {
+	case "DZ":
+		return unzipMDFBlock(b)
+	case "HL":
+		return m.dataReader(b.link(0))
+	case "DL":
+		var readers []io.Reader
+		for {
+			for _, link := range b.links[min(1, len(b.links)):] {
+				r, err := m.dataReader(link)
+				if err != nil {
+					return nil, err
+				}
+				readers = append(readers, r)
+			}
+			next := b.link(0)
+			if next == 0 {
+				return io.MultiReader(readers...), nil
+			}
+			if b, err = m.readBlock(next, "DL"); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data block '%s'", b.id)
+	}
+}
+
+// unzipMDFBlock inflates the data of a DZ block and reverts the
+// transposition of the records.
+func unzipMDFBlock(b *mdfRawBlock) (io.Reader, error) {
+	if len(b.data) < 24 {
+		return nil, errors.New("invalid DZ block")
+	}
+	zipType := b.data[2]
+	columns := int(binary.LittleEndian.Uint32(b.data[4:8]))
+	length := binary.LittleEndian.Uint64(b.data[8:16])
+	zr, err := zlib.NewReader(bytes.NewReader(b.data[24:]))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	switch zipType {
+	case 0: // Deflate
+	case 1: // Transposition and deflate
+		if columns > 0 {
+			rows := len(data) / columns
+			transposed := make([]byte, len(data))
+			for c := 0; c < columns; c++ {
+				for r := 0; r < rows; r++ {
+					transposed[r*columns+c] = data[c*rows+r]
+				}
+			}
+			copy(transposed[rows*columns:], data[rows*columns:])
+			data = transposed
+		}
+	default:
+		return nil, fmt.Errorf("unsupported zip type %d", zipType)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// read returns the next CAN data frame of the stream.
+func (s *mdfStream) read(start time.Time) (*CANMessage, error) {
+	recordID := make([]byte, s.idSize)
+	for {
+		if _, err := io.ReadFull(s.data, recordID); err != nil {
+			return nil, err
+		}
+		var id uint64
+		for i, b := range recordID {
+			id |= uint64(b) << (8 * i)
+		}
+		group, ok := s.groups[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown record ID %d", id)
+		}
+		size := group.size
+		if group.vlsd {
+			var length [4]byte
+			if _, err := io.ReadFull(s.data, length[:]); err != nil {
+				return nil, err
+			}
+			size = int(binary.LittleEndian.Uint32(length[:]))
+		}
+		record := make([]byte, size)
+		if _, err := io.ReadFull(s.data, record); err != nil {
+			return nil, err
+		}
+		if group.signals != nil {
+			return group.decode(record, start), nil
+		}
+	}
+}
+
+// decode converts a CAN_DataFrame record to a message.
+func (g *mdfGroup) decode(record []byte, start time.Time) *CANMessage {
+	value := func(name string) uint64 {
+		if s := g.signals[name]; s != nil {
+			return s.raw(record)
+		}
+		return 0
+	}
+
+	seconds := g.signals["Timestamp"].value(record)
+	msg := &CANMessage{
+		Channel:         strconv.FormatUint(value("BusChannel"), 10),
+		Timestamp:       start.Add(time.Duration(seconds * float64(time.Second))),
+		TimestampSource: TimestampReplay,
+		Direction:       "RX",
+	}
+	if value("Dir") == 1 {
+		msg.Direction = "TX"
+	}
+
+	id := value("ID")
+	frame := Frame{
+		ID:         uint32(id) & 0x1FFFFFFF,
+		IsExtended: value("IDE") == 1 || id&(1<<31) != 0,
+		IsFD:       value("EDL") == 1,
+		BRS:        value("BRS") == 1,
+		ESI:        value("ESI") == 1,
+	}
+	if g.signals["DataLength"] != nil {
+		frame.Length = uint8(value("DataLength"))
+	} else if frame.IsFD {
+		frame.Length = fdDLCToLength(uint8(value("DLC")))
+	} else {
+		frame.Length = uint8(min(value("DLC"), CAN_MAX_DLEN))
+	}
+	if s := g.signals["DataBytes"]; s != nil {
+		data := s.bytes(record)
+		frame.Length = uint8(min(int(frame.Length), len(data), CANFD_MAX_DLEN))
+		copy(frame.Data[:], data[:frame.Length])
+	}
+	msg.Frame = frame
+	return msg
+}
+
+// ReadMessage returns the earliest of the next frames of all data groups.
+func (m *mdfReader) ReadMessage() (CANMessage, error) {
+	if !m.opened {
+		m.opened = true
+		m.err = m.open()
+	}
+	if m.err != nil {
+		err := m.err
+		m.err = io.EOF // Report a broken file once
+		return CANMessage{}, err
+	}
+
+	var earliest *mdfStream
+	for _, stream := range m.streams {
+		if stream.next == nil && !stream.exhausted {
+			msg, err := stream.read(m.start)
+			if err != nil {
+				stream.exhausted = true
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					return CANMessage{}, err
+				}
+			}
+			stream.next = msg
+		}
+		if stream.next != nil && (earliest == nil || stream.next.Timestamp.Before(earliest.next.Timestamp)) {
+			earliest = stream
+		}
+	}
+	if earliest == nil {
+		return CANMessage{}, io.EOF
+	}
+	msg := *earliest.next
+	earliest.next = nil
+	if err := msg.Frame.Validate(); err != nil {
+		return CANMessage{}, err
+	}
+	return msg, nil
+}
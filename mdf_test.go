@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mdfReadBack returns the messages an MDF file keeps of the written ones:
+// MDF stores data frames only, on channels numbered in the order they
+// appear.
+func mdfReadBack(written []CANMessage) []CANMessage {
+	var read []CANMessage
+	for _, msg := range written {
+		if msg.Frame.IsRemote || msg.Frame.IsError {
+			continue
+		}
+		msg.Channel = map[string]string{"can0": "1", "can1": "2"}[msg.Channel]
+		read = append(read, msg)
+	}
+	return read
+}
+
+func TestMDFRoundTrip(t *testing.T) {
+	written := traceTestMessages()
+
+	path := filepath.Join(t.TempDir(), "trace.mf4")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := newMDFWriter(file)
+	for _, msg := range written {
+		if err := writer.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(trace, []byte("MDF     ")) {
+		t.Errorf("file is not finalized: %q", trace[:8])
+	}
+	checkMessages(t, readAllMessages(t, newMDFReader(bytes.NewReader(trace))), mdfReadBack(written))
+}
+
+func TestMDFUnfinalizedRoundTrip(t *testing.T) {
+	written := traceTestMessages()
+
+	// A plain writer can not finalize the file, like a recording that crashed
+	trace := writeTrace(t, newMDFWriter, written)
+	if !bytes.HasPrefix(trace, []byte("UnFinMF ")) {
+		t.Errorf("file is finalized: %q", trace[:8])
+	}
+	checkMessages(t, readAllMessages(t, newMDFReader(bytes.NewReader(trace))), mdfReadBack(written))
+}
+
+func TestMDFMalformed(t *testing.T) {
+	trace := writeTrace(t, newMDFWriter, traceTestMessages())
+
+	broken := bytes.Clone(trace)
+	copy(broken[bytes.Index(broken, []byte("##CG")):], "##XX")
+	for name, data := range map[string][]byte{
+		"no MDF file":          []byte("MDF is a file format for measurement data"),
+		"broken channel group": broken,
+	} {
+		reader := newMDFReader(bytes.NewReader(data))
+		if _, err := reader.ReadMessage(); err == nil || err == io.EOF {
+			t.Errorf("%s: got %v, want an error", name, err)
+		}
+		// The error is reported once
+		if _, err := reader.ReadMessage(); err != io.EOF {
+			t.Errorf("%s: got %v after the error, want io.EOF", name, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ACK behaviors of the in-memory bus.
+const (
+	MemAckAlways = "always" // Every frame is acknowledged
+	MemAckPeers  = "peers"  // Frames are acknowledged if another endpoint is attached
+	MemAckNever  = "never"  // No frame is ever acknowledged
+)
+
+// memQueueSize is the number of frames an endpoint buffers before it starts
+// dropping, similar to a full socket receive queue.
+const memQueueSize = 1024
+
+var errMemNoAck = errors.New("no ACK received")
+
+// memBusOptions configures the behavior of an in-memory bus endpoint.
+type memBusOptions struct {
+	Latency  time.Duration // Delay before a transmitted frame reaches receivers
+	DropRate float64       // Probability (0..1) that a receiver misses a frame
+	Ack      string        // One of MemAckAlways, MemAckPeers or MemAckNever
+}
+
+// parseMemBusOptions reads the options from the query of a mem:// bus URL,
+// e.g. mem://demo?latency=2ms&drop=0.01&ack=peers.
+func parseMemBusOptions(query url.Values) (memBusOptions, error) {
+	opts := memBusOptions{Ack: MemAckAlways}
+	if v := query.Get("latency"); v != "" {
+		latency, err := time.ParseDuration(v)
+		if err != nil || latency < 0 {
+			return opts, fmt.Errorf("invalid latency '%s'", v)
+		}
+		opts.Latency = latency
+	}
+	if v := query.Get("drop"); v != "" {
+		drop, err := strconv.ParseFloat(v, 64)
+		if err != nil || drop < 0 || drop > 1 {
+			return opts, fmt.Errorf("invalid drop rate '%s'", v)
+		}
+		opts.DropRate = drop
+	}
+	if v := query.Get("ack"); v != "" {
+		switch v {
+		case MemAckAlways, MemAckPeers, MemAckNever:
+			opts.Ack = v
+		default:
+			return opts, fmt.Errorf("invalid ack mode '%s'", v)
+		}
+	}
+	return opts, nil
+}
+
+// memHub is a named virtual bus shared by all endpoints attached to it.
+type memHub struct {
+	mu        sync.Mutex
+	endpoints map[*memBus]struct{}
+}
+
+var (
+	memHubsMutex sync.Mutex
+	memHubs      = make(map[string]*memHub)
+)
+
+// getMemHub returns the virtual bus with the given name, creating it on
+// first use.
+func getMemHub(name string) *memHub {
+	memHubsMutex.Lock()
+	defer memHubsMutex.Unlock()
+	hub, ok := memHubs[name]
+	if !ok {
+		hub = &memHub{endpoints: make(map[*memBus]struct{})}
+		memHubs[name] = hub
+	}
+	return hub
+}
+
+// memFrame is a frame queued for delivery to one endpoint.
+type memFrame struct {
+	frame Frame
+	due   time.Time
+}
+
+// memBus is a pure Go, in-process Bus. Every endpoint opened with the same
+// name is attached to the same virtual bus and transmitted frames are looped
+// back to all of them, including the sender.
+type memBus struct {
+	name      string
+	opts      memBusOptions
+	hub       *memHub
+	queue     chan memFrame
+	rx        chan CANMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemBus(name string, opts memBusOptions) *memBus {
+	return &memBus{
+		name:   name,
+		opts:   opts,
+		queue:  make(chan memFrame, memQueueSize),
+		rx:     make(chan CANMessage),
+		closed: make(chan struct{}),
+	}
+}
+
+func (b *memBus) Name() string {
+	return "mem://" + b.name
+}
+
+func (b *memBus) Open(ctx context.Context) error {
+	b.hub = getMemHub(b.name)
+	b.hub.mu.Lock()
+	b.hub.endpoints[b] = struct{}{}
+	b.hub.mu.Unlock()
+
+	go b.deliver()
+	return nil
+}
+
+// deliver hands queued frames to the receive channel once their latency has
+// elapsed.
+func (b *memBus) deliver() {
+	defer close(b.rx)
+
+	for {
+		select {
+		case f := <-b.queue:
+			if wait := time.Until(f.due); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-b.closed:
+					return
+				}
+			}
+			select {
+			case b.rx <- CANMessage{Frame: f.frame, Timestamp: time.Now(), TimestampSource: TimestampUser, Direction: "RX", SentByApp: false}:
+			case <-b.closed:
+				return
+			}
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+func (b *memBus) Receive() <-chan CANMessage {
+	return b.rx
+}
+
+func (b *memBus) Transmit(ctx context.Context, frame Frame) error {
+	if b.hub == nil {
+		return fmt.Errorf("bus '%s' is not open", b.Name())
+	}
+	select {
+	case <-b.closed:
+		return fmt.Errorf("bus '%s' is closed", b.Name())
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := frame.Validate(); err != nil {
+		return err
+	}
+
+	b.hub.mu.Lock()
+	defer b.hub.mu.Unlock()
+
+	switch b.opts.Ack {
+	case MemAckNever:
+		b.reportNoAck()
+		return errMemNoAck
+	case MemAckPeers:
+		if len(b.hub.endpoints) < 2 {
+			b.reportNoAck()
+			return errMemNoAck
+		}
+	}
+
+	due := time.Now().Add(b.opts.Latency)
+	for ep := range b.hub.endpoints {
+		if b.opts.DropRate > 0 && rand.Float64() < b.opts.DropRate {
+			continue
+		}
+		select {
+		case ep.queue <- memFrame{frame: frame, due: due}:
+		default:
+			// Receive queue of the endpoint is full, the frame is lost for it
+		}
+	}
+	return nil
+}
+
+// reportNoAck delivers an ACK error frame to the sender, like a controller
+// does when nobody acknowledges its frame.
+func (b *memBus) reportNoAck() {
+	frame := Frame{ID: CAN_ERR_ACK | CAN_ERR_PROT, Length: CAN_ERR_DLC, IsError: true}
+	frame.Data[2] = 0x80 // Error on transmission
+	frame.Data[3] = 0x19 // In the ACK slot
+	select {
+	case b.queue <- memFrame{frame: frame, due: time.Now().Add(b.opts.Latency)}:
+	default:
+	}
+}
+
+func (b *memBus) Close() error {
+	b.closeOnce.Do(func() {
+		if b.hub != nil {
+			b.hub.mu.Lock()
+			delete(b.hub.endpoints, b)
+			b.hub.mu.Unlock()
+		}
+		close(b.closed)
+	})
+	return nil
+}
+
+func (b *memBus) Capabilities() BusCapabilities {
+	return BusCapabilities{Transmit: true, FD: true, ErrorFrames: true}
+}
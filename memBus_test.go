@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// openMemBus opens an endpoint of the in-memory bus given by spec and closes
+// it at the end of the test.
+func openMemBus(t *testing.T, spec string) Bus {
+	t.Helper()
+	bus, err := newBus(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+// nextMessage returns the next message of ch, failing the test if none
+// arrives within a second.
+func nextMessage(t *testing.T, ch <-chan CANMessage) CANMessage {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	return CANMessage{}
+}
+
+// nextSendStatus returns the next transmission result of a send job.
+func nextSendStatus(t *testing.T) SendStatusMsg {
+	t.Helper()
+	select {
+	case status := <-sendStatusCh:
+		return status
+	case <-time.After(time.Second):
+		t.Fatal("no send status received")
+	}
+	return SendStatusMsg{}
+}
+
+func TestMemBusRoundTrip(t *testing.T) {
+	sender := openMemBus(t, "mem://roundtrip")
+	receiver := openMemBus(t, "mem://roundtrip")
+	go listenForCANCtrl(sender)
+
+	sendMsg := &SendMessage{UUID: uuid.New(), ID: 0x123, DLC: 3, Data: []byte{0xDE, 0xAD, 0x01}}
+	m := initialModel([]*SendMessage{sendMsg}, nil, []Bus{sender}, "")
+	go sendOnce(sendMsg, sender, "manual")
+
+	status := nextSendStatus(t)
+	if status.Err != nil {
+		t.Fatalf("send failed: %v", status.Err)
+	}
+	updated, _ := m.Update(status)
+	m = updated.(Model)
+	if sendMsg.Status != "OK" {
+		t.Errorf("status = %q, want OK", sendMsg.Status)
+	}
+
+	// The other endpoint gets the frame, the sender its TX message and the loopback
+	rx := nextMessage(t, receiver.Receive())
+	if rx.Frame != sendMsg.frame() || rx.Direction != "RX" {
+		t.Errorf("received %v %s, want %v RX", rx.Frame, rx.Direction, sendMsg.frame())
+	}
+	directions := map[string]bool{}
+	for range 2 {
+		msg := nextMessage(t, canMsgCh)
+		if msg.Channel != "mem://roundtrip" || msg.Frame != sendMsg.frame() {
+			t.Errorf("got %v on %s, want %v on mem://roundtrip", msg.Frame, msg.Channel, sendMsg.frame())
+		}
+		directions[msg.Direction] = true
+		updated, _ = m.Update(msg)
+		m = updated.(Model)
+	}
+	if !directions["TX"] || !directions["RX"] {
+		t.Errorf("got directions %v, want TX and RX", directions)
+	}
+
+	key := msgKey{Channel: "mem://roundtrip", ID: 0x123}
+	if stored, ok := m.canMessages[key]; !ok || !stored.SentByApp {
+		t.Errorf("message %v not stored as sent by the app: %+v", key, stored)
+	}
+	if rows := m.receiveTable.Rows(); len(rows) != 1 {
+		t.Errorf("receive table has %d rows, want 1", len(rows))
+	}
+}
+
+func TestMemBusDrop(t *testing.T) {
+	sender := openMemBus(t, "mem://drop?drop=1")
+	receiver := openMemBus(t, "mem://drop")
+
+	if err := sender.Transmit(context.Background(), Frame{ID: 0x42, Length: 1}); err != nil {
+		t.Fatalf("transmit failed: %v", err)
+	}
+	select {
+	case msg := <-receiver.Receive():
+		t.Errorf("dropped frame was received: %v", msg.Frame)
+	case msg := <-sender.Receive():
+		t.Errorf("dropped frame was looped back: %v", msg.Frame)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemBusLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	sender := openMemBus(t, "mem://latency?latency=50ms")
+	receiver := openMemBus(t, "mem://latency")
+
+	start := time.Now()
+	if err := sender.Transmit(context.Background(), Frame{ID: 0x42, Length: 1}); err != nil {
+		t.Fatalf("transmit failed: %v", err)
+	}
+	nextMessage(t, receiver.Receive())
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("frame arrived after %v, want at least %v", elapsed, latency)
+	}
+}
+
+func TestMemBusNoAck(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		peers bool // Attach a second endpoint
+		ack   bool
+	}{
+		{"never", "mem://noack-never?ack=never", true, false},
+		{"peers alone", "mem://noack-alone?ack=peers", false, false},
+		{"peers", "mem://noack-peers?ack=peers", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := openMemBus(t, tt.spec)
+			if tt.peers {
+				openMemBus(t, strings.Split(tt.spec, "?")[0])
+			}
+			sendMsg := &SendMessage{UUID: uuid.New(), ID: 0x10, DLC: 1, Data: []byte{0x01}}
+			go sendOnce(sendMsg, bus, "manual")
+
+			status := nextSendStatus(t)
+			if tt.ack {
+				if status.Err != nil {
+					t.Fatalf("send failed: %v", status.Err)
+				}
+				nextMessage(t, canMsgCh)
+				return
+			}
+			if !errors.Is(status.Err, errMemNoAck) {
+				t.Fatalf("send error = %v, want %v", status.Err, errMemNoAck)
+			}
+			// The sender sees the ACK error like on a real controller
+			msg := nextMessage(t, bus.Receive())
+			if !msg.Frame.IsError || msg.Frame.ID&CAN_ERR_ACK == 0 {
+				t.Errorf("got %v, want an ACK error frame", msg.Frame)
+			}
+		})
+	}
+}
+
+func TestMemBusNoAckStopsCyclicSend(t *testing.T) {
+	bus := openMemBus(t, "mem://noack-cyclic?ack=never")
+	sendMsg := &SendMessage{UUID: uuid.New(), ID: 0x10, DLC: 1, Data: []byte{0x01}, CycleTime: time.Millisecond}
+	m := initialModel([]*SendMessage{sendMsg}, nil, []Bus{bus}, "")
+	sendMsg.startCyclic(bus)
+	defer sendMsg.stopCyclic()
+
+	for i := 1; i <= maxConsecutiveTxFailures; i++ {
+		status := nextSendStatus(t)
+		if !errors.Is(status.Err, errMemNoAck) {
+			t.Fatalf("send error = %v, want %v", status.Err, errMemNoAck)
+		}
+		if status.Stopped != (i == maxConsecutiveTxFailures) {
+			t.Fatalf("failure %d: stopped = %v", i, status.Stopped)
+		}
+		m.Update(status)
+	}
+	if sendMsg.Sending || !strings.HasPrefix(sendMsg.Status, "STOPPED") {
+		t.Errorf("cyclic job still running: sending = %v, status = %q", sendMsg.Sending, sendMsg.Status)
+	}
+	if sendMsg.Errors != maxConsecutiveTxFailures {
+		t.Errorf("errors = %d, want %d", sendMsg.Errors, maxConsecutiveTxFailures)
+	}
+}
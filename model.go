@@ -2,12 +2,13 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -21,10 +22,14 @@ const (
 const (
 	FocusTop = iota
 	FocusBottom
+	FocusWatch
 )
 
 const infoPanelWidth = 30
 
+// rtrMarker is shown instead of the data of remote transmission requests.
+const rtrMarker = "RTR"
+
 type InfoPanelTickMsg time.Time
 
 func infoPanelTickCmd() tea.Cmd {
@@ -39,21 +44,36 @@ type Model struct {
 	receiveTable  table.Model
 	sendTable     table.Model
 	overwriteMode bool
-	canMessages   map[uint32]CANMessage
+	canMessages   map[msgKey]CANMessage
+	logMessages   []CANMessage // Messages of the receive table in log mode
 	sendMessages  []*SendMessage
 	width, height int
 	filterMode    int
-	filteredIDs   map[uint32]struct{}
+	filteredIDs   map[msgKey]struct{} // Filter list, keys without channel match all channels
+	filterInput   textinput.Model     // Filter list prompt, see openFilterPrompt
+	editingFilter bool
+	filterErr     string // Parse error of the filter list prompt
+	channelFilter string // Only show frames of this channel, empty for all channels
 	focus         int
 	form          form
 	showHelp      bool
 	showInfo      bool
 	showLogs      bool
 	showDetail    bool
-	infoPanel     info
+	infoPanels    []info // One per bus, in the order of buses
 	logTable      table.Model
 	detailPanel   detailModel
-	canInterface  string
+	buses         []Bus // Open buses, the first one is the default for sending
+	timestampSource string // Source of the timestamps of the last received frame
+	recorder      *recorder // Active recording, nil if not recording
+	lastRecording string    // File name of the last finished recording or export
+	recordFormat  string    // Format of new recordings, see traceWriters
+	watchTable    table.Model
+	watches       []*watch // Signals of the watch pane
+	showWatch     bool
+	watchInput    textinput.Model // Prompt adding signals to the watch list
+	addingWatch   bool
+	watchErr      string // Parse error of the watch prompt
 }
 
 type detailModel struct {
@@ -91,74 +111,325 @@ func (dm detailModel) View() string {
 	contentBuilder.WriteString(detailViewHeaderStyle.Render("Message Details") + "\n\n")
 
 	// ID, DLC, Cycle
-	infoLine := fmt.Sprintf("ID: 0x%03X | DLC: %d | Cycle: %.3fms", dm.message.Frame.ID, dm.message.Frame.Length, float64(dm.message.CycleTime.Nanoseconds())/1e6)
+	idType := "Standard"
+	if dm.message.Frame.IsExtended {
+		idType = "Extended"
+	} else if dm.message.Frame.IsError {
+		idType = "Error class"
+	}
+	infoLine := fmt.Sprintf("Channel: %s | ID: %s (%s) | DLC: %d | Cycle: %.3fms", dm.message.Channel, formatKey(dm.message.key()), idType, dm.message.Frame.Length, float64(dm.message.CycleTime.Nanoseconds())/1e6)
 	contentBuilder.WriteString(infoLine + "\n")
 
+	// Calculate available content width for binary data (popup is 100% width, but with a small margin)
+	actualPopupWidth := dm.width - 2 // Give it a 1-char margin on each side
+	availableContentWidth := actualPopupWidth - (popupStyle.GetHorizontalPadding() * 2) - (popupStyle.GetHorizontalBorderSize() * 2)
+
+	switch {
+	case dm.message.Frame.IsError:
+		canErr := decodeCANError(dm.message.Frame)
+		contentBuilder.WriteString(fmt.Sprintf("Type: Error Frame | %s\n", strings.Join(canErr.Classes(), ", ")))
+		if state := canErr.ControllerState(); state != "" {
+			contentBuilder.WriteString(fmt.Sprintf("Controller State: %s\n", state))
+		}
+		for _, detail := range canErr.Details() {
+			contentBuilder.WriteString(detail + "\n")
+		}
+		contentBuilder.WriteString(dm.dataView(availableContentWidth))
+	case dm.message.Frame.IsRemote:
+		contentBuilder.WriteString(fmt.Sprintf("Type: Remote Transmission Request (RTR), requested length %d\n", dm.message.Frame.Length))
+	case dm.message.Frame.IsFD:
+		contentBuilder.WriteString(fmt.Sprintf("Type: CAN FD Data Frame | DLC code: %d | BRS: %s | ESI: %s\n", dm.message.Frame.DLC(), yesNo(dm.message.Frame.BRS), yesNo(dm.message.Frame.ESI)))
+		contentBuilder.WriteString(dm.dataView(availableContentWidth))
+	default:
+		contentBuilder.WriteString("Type: Data Frame\n")
+		contentBuilder.WriteString(dm.dataView(availableContentWidth))
+	}
+
+	if dbcMsg := signalDB.message(dm.message.Frame); dbcMsg != nil {
+		values := dbcMsg.decode(dm.message.Frame.Payload())
+		contentBuilder.WriteString("\n" + dbcMessageLine(dbcMsg) + "\n")
+		if page := muxPage(values); page != "" {
+			contentBuilder.WriteString("Multiplexer: " + page + "\n")
+		}
+		contentBuilder.WriteString("\n")
+		// Rows left inside the popup, which has a border and vertical padding
+		used := strings.Count(contentBuilder.String(), "\n")
+		maxRows := dm.height - 4 - popupStyle.GetVerticalFrameSize() - used - 2
+		contentBuilder.WriteString(signalTable(values, max(1, maxRows)))
+	}
+
+	detailBox := popupStyle.Width(actualPopupWidth).Height(dm.height - 4).Render(contentBuilder.String())
+
+	return lipgloss.Place(dm.width, dm.height, lipgloss.Center, lipgloss.Center, detailBox)
+}
+
+// dataView renders the payload of the message in hex and binary.
+func (dm detailModel) dataView(availableContentWidth int) string {
+	contentBuilder := strings.Builder{}
+
+	payload := dm.message.Frame.Payload()
+
 	// Data in Hex
-	hexData := make([]string, len(dm.message.Frame.Data))
-	for i, b := range dm.message.Frame.Data {
+	hexData := make([]string, len(payload))
+	for i, b := range payload {
 		hexData[i] = fmt.Sprintf("%02X", b)
 	}
-	hexLine := fmt.Sprintf("Data (Hex): %s", strings.Join(hexData, " "))
-	contentBuilder.WriteString(hexLine + "\n")
+	contentBuilder.WriteString(wrapBytes("Data (Hex):", hexData, availableContentWidth))
 
 	// Data in Binary
-	binData := make([]string, len(dm.message.Frame.Data))
-	for i, b := range dm.message.Frame.Data {
+	binData := make([]string, len(payload))
+	for i, b := range payload {
 		binData[i] = fmt.Sprintf("%08b", b)
 	}
+	contentBuilder.WriteString(wrapBytes("Data (Binary):", binData, availableContentWidth))
+	return contentBuilder.String()
+}
 
-	// Calculate available content width for binary data (popup is 100% width, but with a small margin)
-	actualPopupWidth := dm.width - 2 // Give it a 1-char margin on each side
-	availableContentWidth := actualPopupWidth - (popupStyle.GetHorizontalPadding() * 2) - (popupStyle.GetHorizontalBorderSize() * 2)
-
-	// Calculate the width if binary data is on one line
-	binaryOneLineContent := fmt.Sprintf("Data (Binary): %s", strings.Join(binData, " "))
-	requiredBinOneLineWidth := lipgloss.Width(binaryOneLineContent)
+// wrapBytes renders formatted bytes after a label. If they do not fit on one
+// line they are wrapped into lines of at most width characters, each
+// prefixed with the offset of its first byte.
+func wrapBytes(label string, cells []string, width int) string {
+	oneLine := fmt.Sprintf("%s %s", label, strings.Join(cells, " "))
+	if lipgloss.Width(oneLine) <= width || len(cells) == 0 {
+		return oneLine + "\n"
+	}
 
-	if requiredBinOneLineWidth <= availableContentWidth {
-		contentBuilder.WriteString(binaryOneLineContent + "\n")
-	} else {
-		contentBuilder.WriteString("Data (Binary):\n")
-		for _, b := range binData {
-			contentBuilder.WriteString(fmt.Sprintf("  %s\n", b))
-		}
+	const offsetWidth = 6 // "  00: "
+	cellWidth := lipgloss.Width(cells[0]) + 1
+	perLine := max(1, (width-offsetWidth)/cellWidth)
+	if perLine >= 8 {
+		perLine -= perLine % 8 // Keep lines aligned to 8 byte boundaries
 	}
 
-	detailBox := popupStyle.Width(actualPopupWidth).Height(dm.height - 4).Render(contentBuilder.String())
+	var b strings.Builder
+	b.WriteString(label + "\n")
+	for start := 0; start < len(cells); start += perLine {
+		end := min(start+perLine, len(cells))
+		fmt.Fprintf(&b, "  %02d: %s\n", start, strings.Join(cells[start:end], " "))
+	}
+	return b.String()
+}
 
-	return lipgloss.Place(dm.width, dm.height, lipgloss.Center, lipgloss.Center, detailBox)
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
 }
 
-func initialModel(messages []*SendMessage, canInterface string) Model {
-	receiveTable := newReceiveTable()
+func initialModel(messages []*SendMessage, watches []*watch, buses []Bus, recordFormat string) Model {
+	infoPanels := make([]info, len(buses))
+	for i, bus := range buses {
+		infoPanels[i] = newInfo(bus.Name())
+	}
+
+	receiveTable := newReceiveTable(signalDB != nil)
 	sendTable := newSendTable()
 
 	model := Model{
 		receiveTable:  receiveTable,
 		sendTable:     sendTable,
-		canMessages:   make(map[uint32]CANMessage),
-		filteredIDs:   make(map[uint32]struct{}),
+		canMessages:   make(map[msgKey]CANMessage),
+		filteredIDs:   make(map[msgKey]struct{}),
 		overwriteMode: true, // Default to overwrite mode
 		focus:         FocusBottom,
-		form:          newForm("", "", "", ""),
+		form:          newForm(nil, nil),
 		showHelp:      false,
 		showInfo:      false,
-		infoPanel:     newInfo(),
+		infoPanels:    infoPanels,
 		sendMessages:  messages,
 		logTable:      table.New(table.WithColumns([]table.Column{})), // Initialize with empty columns
-		canInterface:  canInterface,
+		buses:         buses,
 		detailPanel:   newDetailModel(),
+		recordFormat:  recordFormat,
+		watchTable:    newWatchTable(),
+		watches:       watches,
 	}
 
 	model.updateSendTable()
+	model.updateWatchTable()
 	model.sendTable.Focus()
 	model.receiveTable.Blur()
 	return model
 }
 
+// replays returns the buses that replay trace files.
+func (m Model) replays() []replayControl {
+	var replays []replayControl
+	for _, bus := range m.buses {
+		if replay, ok := bus.(replayControl); ok {
+			replays = append(replays, replay)
+		}
+	}
+	return replays
+}
+
+// nextReplaySpeed returns the replay speed after speed in replaySpeeds, or
+// the one before it when faster is false.
+func nextReplaySpeed(speed float64, faster bool) float64 {
+	for i, s := range replaySpeeds {
+		if s != speed {
+			continue
+		}
+		if faster && i+1 < len(replaySpeeds) {
+			return replaySpeeds[i+1]
+		}
+		if !faster && i > 0 {
+			return replaySpeeds[i-1]
+		}
+		return speed
+	}
+	return 1 // Speeds given on the command line may not be in the list
+}
+
+// rowKey returns the key of the message shown in a row of the receive table.
+func rowKey(row table.Row) (msgKey, error) {
+	key, err := parseID(row[2]) // ID is the third column, after the channel
+	key.Channel = row[1]
+	return key, err
+}
+
+// channelNames returns the names of the open buses.
+func (m Model) channelNames() []string {
+	names := make([]string, len(m.buses))
+	for i, bus := range m.buses {
+		names[i] = bus.Name()
+	}
+	return names
+}
+
+// busFor returns the bus a send message is transmitted on, or nil if its
+// channel is not open. Messages without a channel use the first bus.
+func (m Model) busFor(msg *SendMessage) Bus {
+	if len(m.buses) == 0 {
+		return nil
+	}
+	if msg.Channel == "" {
+		return m.buses[0]
+	}
+	for _, bus := range m.buses {
+		if bus.Name() == msg.Channel {
+			return bus
+		}
+	}
+	return nil
+}
+
+// infoPanelFor returns the info panel of a channel, or nil if the channel is
+// not open.
+func (m Model) infoPanelFor(channel string) *info {
+	for i := range m.infoPanels {
+		if m.infoPanels[i].interfaceName == channel {
+			return &m.infoPanels[i]
+		}
+	}
+	return nil
+}
+
+// updateInfoPanels refreshes the info panels of all channels.
+func (m Model) updateInfoPanels() {
+	for i := range m.infoPanels {
+		m.infoPanels[i].updateInfo()
+	}
+}
+
+// filterChannelNames returns the channels the channel filter cycles through:
+// the open buses, then the other channels seen in replayed traces.
+func (m Model) filterChannelNames() []string {
+	names := m.channelNames()
+	var seen []string
+	for key := range m.canMessages {
+		if !slices.Contains(names, key.Channel) && !slices.Contains(seen, key.Channel) {
+			seen = append(seen, key.Channel)
+		}
+	}
+	sort.Strings(seen)
+	return append(names, seen...)
+}
+
+// nextChannelFilter returns the channel shown after the current one when
+// cycling the channel filter: all channels, then each channel in turn.
+func (m Model) nextChannelFilter() string {
+	names := m.filterChannelNames()
+	if m.channelFilter == "" && len(names) > 0 {
+		return names[0]
+	}
+	for i, name := range names {
+		if name == m.channelFilter && i+1 < len(names) {
+			return names[i+1]
+		}
+	}
+	return ""
+}
+
+// shownKeys returns the keys of the received messages that pass the filters
+// in the order of the receive table in overwrite mode: grouped by channel,
+// standard identifiers first, then extended ones and error frames.
+func (m Model) shownKeys() []msgKey {
+	ids := make([]msgKey, 0, len(m.canMessages))
+	for id := range m.canMessages {
+		if m.isShown(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Channel != ids[j].Channel {
+			return ids[i].Channel < ids[j].Channel
+		}
+		if ids[i].Error != ids[j].Error {
+			return !ids[i].Error
+		}
+		if ids[i].Extended != ids[j].Extended {
+			return !ids[i].Extended
+		}
+		return ids[i].ID < ids[j].ID
+	})
+	return ids
+}
+
+// exportReceiveTable writes the messages of the receive table that pass the
+// filters to a new CSV file.
+func (m *Model) exportReceiveTable() {
+	var messages []CANMessage
+	if m.overwriteMode {
+		for _, key := range m.shownKeys() {
+			messages = append(messages, m.canMessages[key])
+		}
+	} else {
+		for _, msg := range m.logMessages {
+			if m.isShown(msg.key()) {
+				messages = append(messages, msg)
+			}
+		}
+	}
+
+	fileName := recordingFileName(time.Now(), "csv")
+	if err := exportCSV(fileName, messages); err != nil {
+		Log(ERROR, "Failed to export receive table to '%s': %v", fileName, err)
+		return
+	}
+	Log(INFO, "Exported %d messages to '%s'", len(messages), fileName)
+	m.lastRecording = fileName
+}
+
+// isShown reports whether messages with the given key pass the ID and
+// channel filters of the receive table.
+func (m Model) isShown(key msgKey) bool {
+	if m.channelFilter != "" && key.Channel != m.channelFilter {
+		return false
+	}
+	filtered := m.inFilterList(key)
+	switch m.filterMode {
+	case FilterModeWhitelist:
+		return filtered
+	case FilterModeBlacklist:
+		return !filtered
+	}
+	return true
+}
+
 func (m Model) Init() tea.Cmd {
-	return tea.Batch(waitForCANMessage, tea.EnterAltScreen)
+	return tea.Batch(waitForCANMessage, waitForSendStatus, tea.EnterAltScreen)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -166,32 +437,95 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.editingFilter {
+			return updateFilterPrompt(m, msg)
+		}
+		if m.addingWatch {
+			return updateWatchPrompt(m, msg)
+		}
 		if m.form.focused > -1 {
 			return updateForm(m, msg)
 		} else {
 			switch msg.String() {
 			case "q", "ctrl+c":
+				m.stopRecording()
 				return m, tea.Quit
+			case "r":
+				if m.recorder != nil {
+					m.stopRecording()
+					return m, nil
+				}
+				rec, err := startRecording(m.recordFormat)
+				if err != nil {
+					Log(ERROR, "Failed to start recording: %v", err)
+					return m, nil
+				}
+				Log(INFO, "Recording to '%s'", rec.fileName)
+				m.recorder = rec
+				m.lastRecording = ""
+				return m, nil
 			case "?":
 				m.showHelp = !m.showHelp
 				return m, nil
+			case "p":
+				for _, replay := range m.replays() {
+					replay.SetPaused(!replay.Paused())
+				}
+				return m, nil
+			case ".":
+				for _, replay := range m.replays() {
+					if replay.Paused() {
+						replay.Step()
+					}
+				}
+				return m, nil
+			case "+", "-":
+				for _, replay := range m.replays() {
+					replay.SetSpeed(nextReplaySpeed(replay.Speed(), msg.String() == "+"))
+				}
+				return m, nil
 			case "o":
 				m.overwriteMode = !m.overwriteMode
+				m.logMessages = nil
 				return m, nil
 			case "f":
 				m.filterMode = (m.filterMode + 1) % 3
 				m.receiveTable.SetRows([]table.Row{}) // Clear table on filter toggle
+				m.logMessages = nil
+				return m, nil
+			case "c":
+				m.channelFilter = m.nextChannelFilter()
+				m.receiveTable.SetRows([]table.Row{}) // Clear table on filter toggle
+				m.logMessages = nil
+				return m, nil
+			case "x":
+				m.exportReceiveTable()
+				return m, nil
+			case "/":
+				m.openFilterPrompt()
+				return m, nil
+			case "w":
+				m.showWatch = !m.showWatch
+				if !m.showWatch && m.focus == FocusWatch {
+					m.setFocus(FocusBottom)
+				}
+				m.updateLayout()
+				return m, nil
+			case "R":
+				for _, w := range m.watches {
+					w.reset()
+				}
+				m.updateWatchTable()
 				return m, nil
 			case "F":
 				selectedRow := m.receiveTable.SelectedRow()
 				if selectedRow != nil {
-					idStr := selectedRow[1] // ID is the second column now
-					id, err := strconv.ParseUint(strings.TrimPrefix(idStr, "0x"), 16, 32)
+					key, err := rowKey(selectedRow)
 					if err == nil {
-						if _, exists := m.filteredIDs[uint32(id)]; exists {
-							delete(m.filteredIDs, uint32(id))
+						if _, exists := m.filteredIDs[key]; exists {
+							delete(m.filteredIDs, key)
 						} else {
-							m.filteredIDs[uint32(id)] = struct{}{}
+							m.filteredIDs[key] = struct{}{}
 						}
 					}
 				}
@@ -215,10 +549,6 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				if m.showInfo {
 					m.showInfo = false
-					// Stop the bus load monitor goroutine
-					close(m.infoPanel.stopChan)
-					// Re-initialize the stop channel for the next time it's opened
-					m.infoPanel.stopChan = make(chan struct{})
 					return m, nil
 				}
 				if m.showDetail {
@@ -226,64 +556,53 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 				// If no popups are open, clear messages and stop cyclic sending
-				m.canMessages = make(map[uint32]CANMessage)
+				m.canMessages = make(map[msgKey]CANMessage)
 				m.receiveTable.SetRows([]table.Row{})
+				m.logMessages = nil
 				for _, msg := range m.sendMessages {
-					if msg.Sending {
-						msg.done <- true
-						msg.Sending = false
-					}
+					msg.stopCyclic()
 				}
 				m.updateSendTable()
 				return m, nil
 			case "tab":
 				if m.form.focused == -1 {
-					m.focus = (m.focus + 1) % 2
-					if m.focus == FocusTop {
-						m.receiveTable.Focus()
-						m.sendTable.Blur()
-					} else {
-						m.receiveTable.Blur()
-						m.sendTable.Focus()
+					// Top to bottom: receive, watch (if shown) and send pane
+					switch {
+					case m.focus == FocusTop && m.showWatch:
+						m.setFocus(FocusWatch)
+					case m.focus == FocusTop || m.focus == FocusWatch:
+						m.setFocus(FocusBottom)
+					default:
+						m.setFocus(FocusTop)
 					}
 				}
 				return m, nil
 			case "n":
-				var id, dlc, cycleTime, data string
+				if m.focus == FocusWatch {
+					m.openWatchPrompt()
+					return m, nil
+				}
+				var template *SendMessage
 				if m.focus == FocusTop {
 					selectedRow := m.receiveTable.SelectedRow()
 					if selectedRow != nil {
-						id = strings.TrimPrefix(selectedRow[1], "0x") // ID
-						dlc = selectedRow[2] // DLC
-						// Remove "ms" from cycle time string
-						cycleTime = strings.TrimSuffix(selectedRow[3], "ms") // Cycle Time
-						data = selectedRow[4] // Data
+						key, err := rowKey(selectedRow)
+						if canMsg, ok := m.canMessages[key]; err == nil && ok && !canMsg.Frame.IsError {
+							template = sendMessageFromCAN(canMsg)
+						}
 					}
 				}
-				m.form = newForm(id, dlc, cycleTime, data) // Always start with a fresh form
-				m.form.focused = 0
-				for i := range m.form.inputs {
-					m.form.inputs[i].Blur()
-				}
-				m.form.inputs[0].Focus()
+				m.form = newForm(template, m.channelNames()) // Always start with a fresh form
+				m.form.setFocus(0)
 				return m, nil
 			case "e":
 				if m.focus == FocusBottom {
 					selectedRow := m.sendTable.SelectedRow()
 					if selectedRow != nil {
-						// UUID is the first column (index 0)
-						id := strings.TrimPrefix(selectedRow[2], "0x") // ID is the third column (index 2)
-						dlc := selectedRow[3] // DLC is the fourth column (index 3)
-						cycleTime := strings.TrimSuffix(selectedRow[4], "ms") // Cycle Time is the fifth column (index 4)
-						data := selectedRow[5] // Data is the sixth column (index 5)
-
-						m.form = newForm(id, dlc, cycleTime, data) // Populate form for editing
+						msg := m.sendMessages[m.sendTable.Cursor()]
+						m.form = newForm(msg, m.channelNames()) // Populate form for editing
 						m.form.editingUUID = selectedRow[0] // Store UUID for update
-						m.form.focused = 0
-						for i := range m.form.inputs {
-							m.form.inputs[i].Blur()
-						}
-						m.form.inputs[0].Focus()
+						m.form.setFocus(0)
 						return m, nil
 					}
 				}
@@ -294,10 +613,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if m.showDetail {
 						selectedRow := m.receiveTable.SelectedRow()
 						if selectedRow != nil {
-							idStr := selectedRow[1] // ID is the second column
-							id, err := strconv.ParseUint(strings.TrimPrefix(idStr, "0x"), 16, 32)
+							key, err := rowKey(selectedRow)
 							if err == nil {
-								if msg, ok := m.canMessages[uint32(id)]; ok {
+								if msg, ok := m.canMessages[key]; ok {
 									m.detailPanel.message = msg
 									m.detailPanel.visible = true
 								}
@@ -309,6 +627,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "backspace", "delete": // New keybinding for deleting send messages
+				if m.focus == FocusWatch {
+					m.removeSelectedWatch()
+					return m, nil
+				}
 				if m.focus == FocusBottom {
 					selectedRow := m.sendTable.SelectedRow()
 					if selectedRow != nil {
@@ -318,9 +640,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							if msg.UUID.String() != selectedUUID {
 								newSendMessages = append(newSendMessages, msg)
 							} else {
-								if msg.Sending {
-									msg.done <- true // Stop cyclic sending if active
-								}
+								msg.stopCyclic() // Stop cyclic sending if active
 							}
 						}
 						m.sendMessages = newSendMessages
@@ -331,6 +651,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			case "ctrl+s":
 				saveMessages(m.sendMessages)
+				saveWatches(m.watches)
 				return m, nil
 			case "ctrl+l":
 				loadedMessages, err := loadMessages()
@@ -338,12 +659,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.sendMessages = loadedMessages
 					m.updateSendTable()
 				}
+				if watches, err := loadWatches(); err == nil {
+					m.watches = watches
+					m.updateWatchTable()
+				} else {
+					Log(ERROR, "Error loading watch list: %v", err)
+				}
 				return m, nil
 			case "ctrl+d":
 				for _, msg := range m.sendMessages {
-					if msg.Sending {
-						msg.done <- true // Stop cyclic sending if active
-					}
+					msg.stopCyclic() // Stop cyclic sending if active
 				}
 				m.sendMessages = []*SendMessage{} // Clear all messages
 				m.updateSendTable()
@@ -352,14 +677,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "i":
 				m.showInfo = !m.showInfo
 				if m.showInfo {
-					go m.infoPanel.startBusLoadMonitor() // Start the bus load monitor goroutine
-					m.infoPanel.updateInfo()
+					m.updateInfoPanels()
 					return m, infoPanelTickCmd()
-				} else {
-					// Stop the bus load monitor goroutine
-					close(m.infoPanel.stopChan)
-					// Re-initialize the stop channel for the next time it's opened
-					m.infoPanel.stopChan = make(chan struct{})
 				}
 				return m, nil
 			case " ": // Spacebar to send message
@@ -367,16 +686,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					selectedRow := m.sendTable.SelectedRow()
 					if selectedRow != nil {
 						msg := m.sendMessages[m.sendTable.Cursor()]
+						bus := m.busFor(msg)
+						if bus == nil {
+							Log(WARNING, "Channel '%s' of %s is not open", msg.Channel, formatID(msg.ID, msg.Extended))
+							return m, nil
+						}
+						if !bus.Capabilities().Transmit {
+							Log(WARNING, "Bus '%s' does not support sending", bus.Name())
+							return m, nil
+						}
 						if msg.CycleTime > 0 {
 							if msg.Sending {
-								msg.done <- true
-								msg.Sending = false
+								msg.stopCyclic()
 							} else {
-								msg.Sending = true
-								go sendCyclic(msg, m.canInterface)
+								msg.startCyclic(bus)
 							}
 						} else {
-							go sendOnce(msg, m.canInterface)
+							go sendOnce(msg, bus, "manual")
 						}
 						m.updateSendTable()
 					}
@@ -384,9 +710,28 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 		}
+	case SendStatusMsg:
+		for _, sendMsg := range m.sendMessages {
+			if sendMsg.UUID != msg.UUID {
+				continue
+			}
+			if msg.Err != nil {
+				sendMsg.Errors++
+				sendMsg.Status = "ERR: " + txErrorText(msg.Err)
+			} else {
+				sendMsg.Status = "OK"
+			}
+			// Ignore stop reports of an earlier run of the cyclic job
+			if msg.Stopped && sendMsg.Sending && sendMsg.stop == msg.stop {
+				sendMsg.Sending = false
+				sendMsg.Status = "STOPPED: " + txErrorText(msg.Err)
+			}
+		}
+		m.updateSendTable()
+		return m, waitForSendStatus
 	case InfoPanelTickMsg:
 		if m.showInfo {
-			m.infoPanel.updateInfo()
+			m.updateInfoPanels()
 			return m, infoPanelTickCmd()
 		}
 		return m, nil
@@ -401,14 +746,37 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.detailPanel = updatedDetailModel.(detailModel)
 		cmd = tea.Batch(cmd, detailCmd)
 	case CANMessage:
-		if msg.Direction == "RX" && m.canMessages[msg.Frame.ID].SentByApp {
+		key := msg.key()
+		// Record all traffic, including frames with the ID of a sent message
+		if m.recorder != nil {
+			m.recorder.record(msg)
+		}
+
+		if msg.Direction == "RX" && m.canMessages[key].SentByApp {
 			return m, waitForCANMessage // Ignore echoed message
 		}
 
+		infoPanel := m.infoPanelFor(msg.Bus)
+		if msg.Direction == "RX" {
+			m.timestampSource = msg.TimestampSource
+			if infoPanel != nil {
+				infoPanel.timestampSource = msg.TimestampSource
+			}
+		}
+
+		if infoPanel != nil {
+			if msg.Frame.IsError {
+				infoPanel.recordError(msg)
+			} else {
+				// Account every frame on the wire once for the bus load estimate
+				infoPanel.recordFrame(msg.Frame)
+			}
+		}
+
 		// Create a new CANMessage to store, copying relevant fields
 		msgToStore := msg
 
-		prevMsg, exists := m.canMessages[msg.Frame.ID]
+		prevMsg, exists := m.canMessages[key]
 		if exists {
 			// Only calculate cycle time for received messages
 			if !msgToStore.SentByApp {
@@ -419,45 +787,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				msgToStore.SentByApp = true
 			}
 		}
-		m.canMessages[msg.Frame.ID] = msgToStore
+		m.canMessages[key] = msgToStore
+
+		// Answer remote requests of other nodes with the configured messages
+		if msg.Frame.IsRemote && msg.Direction == "RX" {
+			for _, sendMsg := range m.sendMessages {
+				bus := m.busFor(sendMsg)
+				if bus != nil && bus.Name() == msg.Bus && bus.Capabilities().Transmit && sendMsg.repliesTo(msg.Frame) {
+					go sendOnce(sendMsg, bus, "rtr")
+				}
+			}
+		}
+
+		if m.updateWatches(msgToStore) {
+			m.updateWatchTable()
+		}
 
 		// Update detail panel if visible and message ID matches
-		if m.showDetail && m.detailPanel.visible && m.detailPanel.message.Frame.ID == msg.Frame.ID {
+		if m.showDetail && m.detailPanel.visible && m.detailPanel.message.key() == key {
 			m.detailPanel.message = msgToStore
 		}
 
-		switch m.filterMode {
-		case FilterModeWhitelist:
-			if _, ok := m.filteredIDs[msg.Frame.ID]; !ok {
-				return m, waitForCANMessage
-			}
-		case FilterModeBlacklist:
-			if _, ok := m.filteredIDs[msg.Frame.ID]; ok {
-				return m, waitForCANMessage
-			}
+		if !m.isShown(key) {
+			return m, waitForCANMessage
 		}
 
 		var rows []table.Row
 		if m.overwriteMode {
-			ids := make([]uint32, 0, len(m.canMessages))
-			for id := range m.canMessages {
-				add := true
-				switch m.filterMode {
-				case FilterModeWhitelist:
-					if _, ok := m.filteredIDs[id]; !ok {
-						add = false
-					}
-				case FilterModeBlacklist:
-					if _, ok := m.filteredIDs[id]; ok {
-						add = false
-					}
-				}
-				if add {
-					ids = append(ids, id)
-				}
-			}
-			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
-			for _, id := range ids {
+			for _, id := range m.shownKeys() {
 				rows = append(rows, m.canMessageToRow(m.canMessages[id]))
 			}
 		} else {
@@ -465,7 +822,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// or a message sent by the app. Filter out echoed messages.
 			shouldAdd := true
 			if !msgToStore.SentByApp { // If it's a received message
-				if existingMsg, ok := m.canMessages[msg.Frame.ID]; ok && existingMsg.SentByApp {
+				if existingMsg, ok := m.canMessages[key]; ok && existingMsg.SentByApp {
 					// If there's an existing message with the same ID that was sent by the app,
 					// and this is a received message, then it's an echo. Don't add it.
 					shouldAdd = false
@@ -475,6 +832,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if shouldAdd {
 				rows = m.receiveTable.Rows()
 				rows = append(rows, m.canMessageToRow(msgToStore))
+				m.logMessages = append(m.logMessages, msgToStore)
 				m.receiveTable.GotoBottom()
 			}
 		}
@@ -488,6 +846,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.logTable, cmd = m.logTable.Update(msg)
 	} else if m.focus == FocusTop {
 		m.receiveTable, cmd = m.receiveTable.Update(msg)
+	} else if m.focus == FocusWatch {
+		m.watchTable, cmd = m.watchTable.Update(msg)
 	} else {
 		m.sendTable, cmd = m.sendTable.Update(msg)
 	}
@@ -495,16 +855,40 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 
+// setFocus moves the focus to a pane.
+func (m *Model) setFocus(focus int) {
+	m.focus = focus
+	m.receiveTable.Blur()
+	m.watchTable.Blur()
+	m.sendTable.Blur()
+	switch focus {
+	case FocusTop:
+		m.receiveTable.Focus()
+	case FocusWatch:
+		m.watchTable.Focus()
+	default:
+		m.sendTable.Focus()
+	}
+}
+
 func (m *Model) updateLayout() {
 	mainViewHeight := m.height - 2 // For header and footer
+	tableWidth := m.width - 2
+	if m.showWatch {
+		watchPaneHeight := mainViewHeight / 3
+		mainViewHeight -= watchPaneHeight
+		m.watchTable.SetWidth(tableWidth)
+		m.watchTable.SetHeight(watchPaneHeight - 2)
+	}
 	topPaneHeight := mainViewHeight / 2
 	bottomPaneHeight := mainViewHeight - topPaneHeight
-	tableWidth := m.width - 2
 
 	m.receiveTable.SetWidth(tableWidth)
 	m.receiveTable.SetHeight(topPaneHeight - 2)
+	fitDataColumn(&m.receiveTable, tableWidth)
 	m.sendTable.SetWidth(tableWidth)
 	m.sendTable.SetHeight(bottomPaneHeight - 2)
+	fitDataColumn(&m.sendTable, tableWidth)
 }
 
 func (m Model) View() string {
@@ -521,7 +905,7 @@ func (m Model) View() string {
 	}
 
 	if m.showInfo {
-		return m.infoPanel.View(m)
+		return m.renderInfoView()
 	}
 
 	if m.showDetail {
@@ -530,13 +914,23 @@ func (m Model) View() string {
 
 	header := headerStyle.Width(m.width).Render("NerdCAN")
 	statusBar := m.renderStatusBar()
+	if m.editingFilter {
+		statusBar = m.renderFilterPrompt()
+	}
+	if m.addingWatch {
+		statusBar = m.renderWatchPrompt()
+	}
 
 	topPaneStyle := inactiveBorderStyle
+	watchPaneStyle := inactiveBorderStyle
 	bottomPaneStyle := inactiveBorderStyle
 
-	if m.focus == FocusTop {
+	switch m.focus {
+	case FocusTop:
 		topPaneStyle = activeBorderStyle
-	} else {
+	case FocusWatch:
+		watchPaneStyle = activeBorderStyle
+	default:
 		bottomPaneStyle = activeBorderStyle
 	}
 
@@ -544,6 +938,10 @@ func (m Model) View() string {
 	bottomPane := bottomPaneStyle.Width(m.width - 2).Render(m.sendTable.View())
 
 	mainView := lipgloss.JoinVertical(lipgloss.Left, topPane, bottomPane)
+	if m.showWatch {
+		watchPane := watchPaneStyle.Width(m.width - 2).Render(m.watchTable.View())
+		mainView = lipgloss.JoinVertical(lipgloss.Left, topPane, watchPane, bottomPane)
+	}
 
 	return lipgloss.JoinVertical(lipgloss.Left, header, mainView, statusBar)
 }
@@ -566,12 +964,19 @@ func (m *Model) renderHelpView() string {
 	addLine(" q: quit")
 	addLine(" ?: toggle help")
 	addLine(" i: toggle info panel")
+	addLine(" r: start/stop recording")
+	addLine(" p: pause/resume replay")
+	addLine(" .: replay next frame while paused")
+	addLine(" +/-: change replay speed")
 	addLine("")
 
 	addLine(lipgloss.NewStyle().Bold(true).Render("RECEIVE PANE"))
 	addLine(" o: toggle mode (overwrite/log)")
 	addLine(" f: cycle filter mode")
 	addLine(" F: add/remove selected ID to filter")
+	addLine(" /: edit filter list (IDs or DBC names)")
+	addLine(" c: cycle channel filter")
+	addLine(" x: export table to CSV")
 	addLine(" esc: clear all received messages")
 	addLine(" tab: switch focus")
 	addLine("")
@@ -587,6 +992,13 @@ func (m *Model) renderHelpView() string {
 	addLine(" i: toggle info panel")
 	addLine(" esc: stop all cyclic messages")
 	addLine(" tab: switch focus")
+	addLine("")
+
+	addLine(lipgloss.NewStyle().Bold(true).Render("WATCH PANE"))
+	addLine(" w: show/hide watch pane")
+	addLine(" n: watch signals (Message.Signal)")
+	addLine(" backspace: remove selected signal")
+	addLine(" R: reset min/max")
 
 	// Add padding for the border
 	helpBoxWidth := maxWidth + popupStyle.GetHorizontalPadding() + popupStyle.GetHorizontalBorderSize()
@@ -612,7 +1024,29 @@ func (m *Model) renderStatusBar() string {
 		filterStatus = "Blacklist"
 	}
 
-	statusLeft := fmt.Sprintf(" %s | %d msgs | Filter: %s", mode, len(m.canMessages), filterStatus)
+	timestampSource := m.timestampSource
+	if timestampSource == "" {
+		timestampSource = "-"
+	}
+
+	channel := m.channelFilter
+	if channel == "" {
+		channel = "all"
+	}
+
+	statusLeft := fmt.Sprintf(" %s | %d msgs | Filter: %s | Ch: %s | TS: %s", mode, len(m.canMessages), filterStatus, channel, timestampSource)
+	if replays := m.replays(); len(replays) > 0 {
+		if replays[0].Paused() {
+			statusLeft += " | Replay paused"
+		} else {
+			statusLeft += " | Replay " + formatReplaySpeed(replays[0].Speed())
+		}
+	}
+	if m.recorder != nil {
+		statusLeft += fmt.Sprintf(" | ● REC %s %d frames", time.Since(m.recorder.started).Truncate(time.Second), m.recorder.frames)
+	} else if m.lastRecording != "" {
+		statusLeft += " | Saved " + m.lastRecording
+	}
 
 	statusRight := "? for help"
 	if m.hasNewErrorLogs() && !m.showLogs {
@@ -632,6 +1066,20 @@ func (m *Model) renderStatusBar() string {
 	return statusStyle.Width(m.width).Render(finalStatus)
 }
 
+// stopRecording finishes the active recording, if any.
+func (m *Model) stopRecording() {
+	if m.recorder == nil {
+		return
+	}
+	if err := m.recorder.stop(); err != nil {
+		Log(ERROR, "Failed to finish recording '%s': %v", m.recorder.fileName, err)
+	} else {
+		Log(INFO, "Recorded %d frames to '%s'", m.recorder.frames, m.recorder.fileName)
+	}
+	m.lastRecording = m.recorder.fileName
+	m.recorder = nil
+}
+
 func (m *Model) hasNewErrorLogs() bool {
 	newErrorFlagMutex.Lock()
 	defer newErrorFlagMutex.Unlock()
@@ -641,14 +1089,21 @@ func (m *Model) hasNewErrorLogs() bool {
 
 func (m *Model) canMessageToRow(msg CANMessage) table.Row {
 	cycleTimeMs := float64(msg.CycleTime.Nanoseconds()) / 1e6
-	dataBytes := make([]string, len(msg.Frame.Data))
-	for i, b := range msg.Frame.Data {
+	payload := msg.Frame.Payload()
+	dataBytes := make([]string, len(payload))
+	for i, b := range payload {
 		dataBytes[i] = fmt.Sprintf("%02X", b)
 	}
 	dataStr := strings.Join(dataBytes, " ")
+	if msg.Frame.IsRemote {
+		dataStr = rtrMarker
+	}
+	if msg.Frame.IsError {
+		dataStr = decodeCANError(msg.Frame).String()
+	}
 
 	indicator := "  "
-	if _, ok := m.filteredIDs[msg.Frame.ID]; ok {
+	if m.inFilterList(msg.key()) {
 		indicator = "• "
 	}
 
@@ -659,14 +1114,27 @@ func (m *Model) canMessageToRow(msg CANMessage) table.Row {
 		directionIcon = "▼"
 	}
 
-	return table.Row{
+	row := table.Row{
 		fmt.Sprintf("%s%s", indicator, directionIcon),
-		fmt.Sprintf("0x%03X", msg.Frame.ID),
+		msg.Channel,
+		formatKey(msg.key()),
+	}
+	if signalDB != nil {
+		name := ""
+		if dbcMsg := signalDB.lookup(msg.Frame.ID, msg.Frame.IsExtended); dbcMsg != nil {
+			name = dbcMsg.displayName()
+		} else if !msg.Frame.IsError {
+			name = unknownMessageName
+		}
+		row = append(row, name)
+	}
+	return append(row,
 		fmt.Sprintf("%d", msg.Frame.Length),
+		msg.Frame.TypeString(),
 		fmt.Sprintf("%.3fms", cycleTimeMs),
 		dataStr,
-		msg.Timestamp.Format("15:04:05.000"),
-	}
+		msg.Timestamp.Format("15:04:05.000000"),
+	)
 }
 
 func (m *Model) updateSendTable() {
@@ -687,11 +1155,20 @@ func (m *Model) sendMessageToRow(msg *SendMessage) table.Row {
 		dataBytes[i] = fmt.Sprintf("%02X", b)
 	}
 	dataStr := strings.Join(dataBytes, " ")
+	if msg.Remote {
+		dataStr = rtrMarker
+	}
+	channel := msg.Channel
+	if channel == "" && len(m.buses) > 0 {
+		channel = m.buses[0].Name()
+	}
 	return table.Row{
 		msg.UUID.String(),
 		indicator,
-		fmt.Sprintf("0x%03X", msg.ID),
+		channel,
+		formatID(msg.ID, msg.Extended),
 		fmt.Sprintf("%d", msg.DLC),
+		msg.frame().TypeString(),
 		func() string {
 			if msg.CycleTime == 0 {
 				return ""
@@ -700,5 +1177,7 @@ func (m *Model) sendMessageToRow(msg *SendMessage) table.Row {
 		}(),
 		dataStr,
 		msg.TriggerType,
+		fmt.Sprintf("%d", msg.Errors),
+		msg.Status,
 	}
 }
\ No newline at end of file
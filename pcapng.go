@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// pcapng block types.
+const (
+	pcapngSectionHeader        = 0x0A0D0D0A
+	pcapngInterfaceDescription = 0x00000001
+	pcapngEnhancedPacket       = 0x00000006
+)
+
+// pcapng option codes.
+const (
+	pcapngOptEnd      = 0
+	pcapngOptUserAppl = 4  // shb_userappl
+	pcapngOptIfName   = 2  // if_name
+	pcapngOptTsResol  = 9  // if_tsresol
+	pcapngOptTsOffset = 14 // if_tsoffset
+	pcapngOptFlags    = 2  // epb_flags
+)
+
+const (
+	pcapngByteOrderMagic = 0x1A2B3C4D
+	// linktypeCANSocketCAN carries struct can_frame or canfd_frame with
+	// the identifier in network byte order.
+	linktypeCANSocketCAN = 227
+)
+
+// Direction in the lowest two bits of epb_flags.
+const (
+	pcapngInbound  = 1
+	pcapngOutbound = 2
+)
+
+// pcapngWriter writes messages as pcapng capture with LINKTYPE_CAN_SOCKETCAN,
+// which Wireshark dissects as CAN. Every channel gets its own interface with
+// nanosecond timestamps.
+type pcapngWriter struct {
+	w          *bufio.Writer
+	interfaces map[string]uint32
+	started    bool
+}
+
+func newPcapngWriter(w io.Writer) traceWriter {
+	return &pcapngWriter{w: bufio.NewWriter(w), interfaces: make(map[string]uint32)}
+}
+
+// appendPcapngOption appends an option with its value padded to 32 bits.
+func appendPcapngOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pcapngPadding(len(value)))...)
+}
+
+func pcapngPadding(n int) int {
+	return (4 - n%4) % 4
+}
+
+// writeBlock writes a block with the given body, which must be padded to 32
+// bits.
+func (p *pcapngWriter) writeBlock(blockType uint32, body []byte) error {
+	length := uint32(12 + len(body))
+	b := binary.LittleEndian.AppendUint32(nil, blockType)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	_, err := p.w.Write(b)
+	return err
+}
+
+func (p *pcapngWriter) writeSectionHeader() error {
+	p.started = true
+	body := binary.LittleEndian.AppendUint32(nil, pcapngByteOrderMagic)
+	body = binary.LittleEndian.AppendUint16(body, 1)              // Major version
+	body = binary.LittleEndian.AppendUint16(body, 0)              // Minor version
+	body = binary.LittleEndian.AppendUint64(body, math.MaxUint64) // Section length not specified
+	body = appendPcapngOption(body, pcapngOptUserAppl, []byte("NerdCAN"))
+	body = appendPcapngOption(body, pcapngOptEnd, nil)
+	return p.writeBlock(pcapngSectionHeader, body)
+}
+
+// iface returns the interface ID of a channel and describes the interface
+// when the channel appears for the first time.
+func (p *pcapngWriter) iface(channel string) (uint32, error) {
+	if id, ok := p.interfaces[channel]; ok {
+		return id, nil
+	}
+	id := uint32(len(p.interfaces))
+	p.interfaces[channel] = id
+
+	body := binary.LittleEndian.AppendUint16(nil, linktypeCANSocketCAN)
+	body = binary.LittleEndian.AppendUint16(body, 0)         // Reserved
+	body = binary.LittleEndian.AppendUint32(body, CANFD_MTU) // Snap length
+	body = appendPcapngOption(body, pcapngOptIfName, []byte(channel))
+	body = appendPcapngOption(body, pcapngOptTsResol, []byte{9}) // Nanoseconds
+	body = appendPcapngOption(body, pcapngOptEnd, nil)
+	return id, p.writeBlock(pcapngInterfaceDescription, body)
+}
+
+func (p *pcapngWriter) WriteMessage(msg CANMessage) error {
+	if !p.started {
+		if err := p.writeSectionHeader(); err != nil {
+			return err
+		}
+	}
+	id, err := p.iface(msg.Channel)
+	if err != nil {
+		return err
+	}
+
+	packet := marshalPcapCANFrame(msg.Frame)
+	timestamp := uint64(msg.Timestamp.UnixNano())
+	flags := uint32(pcapngInbound)
+	if msg.Direction == "TX" {
+		flags = pcapngOutbound
+	}
+
+	body := binary.LittleEndian.AppendUint32(nil, id)
+	body = binary.LittleEndian.AppendUint32(body, uint32(timestamp>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(timestamp))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(packet))) // Captured length
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(packet))) // Original length
+	body = append(body, packet...)
+	body = append(body, make([]byte, pcapngPadding(len(packet)))...)
+	body = appendPcapngOption(body, pcapngOptFlags, binary.LittleEndian.AppendUint32(nil, flags))
+	body = appendPcapngOption(body, pcapngOptEnd, nil)
+	return p.writeBlock(pcapngEnhancedPacket, body)
+}
+
+func (p *pcapngWriter) Close() error {
+	if !p.started {
+		if err := p.writeSectionHeader(); err != nil {
+			return err
+		}
+	}
+	return p.w.Flush()
+}
+
+// marshalPcapCANFrame encodes a frame as LINKTYPE_CAN_SOCKETCAN packet.
+func marshalPcapCANFrame(frame Frame) []byte {
+	b := marshalSocketcanFrame(frame)
+	idAndFlags := binary.NativeEndian.Uint32(b[0:4])
+	if frame.IsError {
+		idAndFlags = frame.ID | CAN_ERR_FLAG
+	}
+	binary.BigEndian.PutUint32(b[0:4], idAndFlags)
+	return b
+}
+
+// unmarshalPcapCANFrame decodes a LINKTYPE_CAN_SOCKETCAN packet. Packets may
+// be truncated after the payload.
+func unmarshalPcapCANFrame(packet []byte) (Frame, error) {
+	if len(packet) < 8 {
+		return Frame{}, errors.New("truncated CAN packet")
+	}
+	size := CAN_MTU
+	if len(packet) > CAN_MTU || packet[5]&CANFD_FDF != 0 {
+		size = CANFD_MTU
+	}
+	b := make([]byte, size)
+	copy(b, packet)
+	binary.NativeEndian.PutUint32(b[0:4], binary.BigEndian.Uint32(packet[0:4]))
+	frame := unmarshalSocketcanFrame(b)
+	if !frame.IsError && len(packet) < 8+len(frame.Payload()) {
+		return Frame{}, errors.New("truncated CAN packet")
+	}
+	return frame, nil
+}
+
+// pcapngInterface is an interface described in a pcapng section.
+type pcapngInterface struct {
+	name     string
+	linkType uint16
+	tsUnit   float64 // Length of a timestamp tick in nanoseconds
+	tsOffset int64   // Seconds added to every timestamp
+}
+
+// pcapngReader reads the CAN frames of pcapng captures. Packets of other
+// link types are skipped.
+type pcapngReader struct {
+	r          *bufio.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+	corrupt    bool // The block structure is broken, the rest is skipped
+}
+
+func newPcapngReader(r io.Reader) traceReader {
+	return &pcapngReader{r: bufio.NewReader(r), order: binary.LittleEndian}
+}
+
+// readBlock returns the type and body of the next block.
+func (p *pcapngReader) readBlock() (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errors.New("truncated block")
+		}
+		return 0, nil, err
+	}
+	blockType := p.order.Uint32(header[0:4])
+	if blockType == pcapngSectionHeader {
+		// The byte order of a section is defined by its header
+		magic, err := p.r.Peek(4)
+		if err != nil {
+			return 0, nil, errors.New("truncated section header")
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == pcapngByteOrderMagic:
+			p.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == pcapngByteOrderMagic:
+			p.order = binary.BigEndian
+		default:
+			return 0, nil, errors.New("not a pcapng file")
+		}
+	}
+	length := p.order.Uint32(header[4:8])
+	if length < 12 || length%4 != 0 || length > 1<<24 {
+		return 0, nil, fmt.Errorf("invalid block length %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(p.r, body); err != nil {
+		return 0, nil, errors.New("truncated block")
+	}
+	return blockType, body[:len(body)-4], nil
+}
+
+// parseOptions calls fn for every option in b.
+func (p *pcapngReader) parseOptions(b []byte, fn func(code uint16, value []byte)) {
+	for len(b) >= 4 {
+		code := p.order.Uint16(b[0:2])
+		length := int(p.order.Uint16(b[2:4]))
+		b = b[4:]
+		if code == pcapngOptEnd || length > len(b) {
+			return
+		}
+		fn(code, b[:length])
+		b = b[min(len(b), length+pcapngPadding(length)):]
+	}
+}
+
+// ReadMessage returns the next CAN frame of the capture.
+func (p *pcapngReader) ReadMessage() (CANMessage, error) {
+	for {
+		if p.corrupt {
+			return CANMessage{}, io.EOF
+		}
+		blockType, body, err := p.readBlock()
+		if err != nil {
+			p.corrupt = err != io.EOF
+			return CANMessage{}, err
+		}
+		switch blockType {
+		case pcapngSectionHeader:
+			p.interfaces = nil
+		case pcapngInterfaceDescription:
+			if len(body) < 8 {
+				return CANMessage{}, errors.New("truncated interface description")
+			}
+			iface := pcapngInterface{
+				name:     fmt.Sprintf("%d", len(p.interfaces)),
+				linkType: p.order.Uint16(body[0:2]),
+				tsUnit:   1000, // Microseconds by default
+			}
+			p.parseOptions(body[8:], func(code uint16, value []byte) {
+				switch {
+				case code == pcapngOptIfName:
+					iface.name = string(value)
+				case code == pcapngOptTsResol && len(value) == 1:
+					if value[0]&0x80 != 0 {
+						iface.tsUnit = 1e9 / math.Pow(2, float64(value[0]&0x7F))
+					} else {
+						iface.tsUnit = 1e9 / math.Pow(10, float64(value[0]))
+					}
+				case code == pcapngOptTsOffset && len(value) == 8:
+					iface.tsOffset = int64(p.order.Uint64(value))
+				}
+			})
+			p.interfaces = append(p.interfaces, iface)
+		case pcapngEnhancedPacket:
+			msg, ok, err := p.parsePacket(body)
+			if err != nil || ok {
+				return msg, err
+			}
+		}
+	}
+}
+
+// parsePacket decodes an enhanced packet block. ok is false for packets of
+// interfaces with other link types.
+func (p *pcapngReader) parsePacket(body []byte) (msg CANMessage, ok bool, err error) {
+	if len(body) < 20 {
+		return msg, false, errors.New("truncated packet block")
+	}
+	id := p.order.Uint32(body[0:4])
+	if int(id) >= len(p.interfaces) {
+		return msg, false, fmt.Errorf("packet of unknown interface %d", id)
+	}
+	iface := p.interfaces[id]
+	if iface.linkType != linktypeCANSocketCAN {
+		return msg, false, nil
+	}
+	capturedLength := int(p.order.Uint32(body[12:16]))
+	if 20+capturedLength > len(body) {
+		return msg, false, errors.New("truncated packet block")
+	}
+	frame, err := unmarshalPcapCANFrame(body[20 : 20+capturedLength])
+	if err != nil {
+		return msg, false, err
+	}
+
+	ticks := uint64(p.order.Uint32(body[4:8]))<<32 | uint64(p.order.Uint32(body[8:12]))
+	var timestamp time.Time
+	if iface.tsUnit == 1 {
+		timestamp = time.Unix(iface.tsOffset, int64(ticks))
+	} else {
+		timestamp = time.Unix(iface.tsOffset, 0).Add(time.Duration(float64(ticks) * iface.tsUnit))
+	}
+
+	msg = CANMessage{Frame: frame, Channel: iface.name, Timestamp: timestamp, TimestampSource: TimestampReplay, Direction: "RX"}
+	// Options follow the padded packet data, a block without padding has none
+	var options []byte
+	if end := 20 + capturedLength + pcapngPadding(capturedLength); end <= len(body) {
+		options = body[end:]
+	}
+	p.parseOptions(options, func(code uint16, value []byte) {
+		if code == pcapngOptFlags && len(value) == 4 && p.order.Uint32(value)&0x3 == pcapngOutbound {
+			msg.Direction = "TX"
+		}
+	})
+	return msg, true, nil
+}
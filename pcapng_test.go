@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestPcapngTruncatedCapture(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newPcapngWriter(&buf)
+	frame := Frame{ID: 0x123, Length: 3, Data: [64]byte{1, 2, 3}}
+	for i := 0; i < 3; i++ {
+		msg := CANMessage{Frame: frame, Channel: "can0", Timestamp: time.Unix(1700000000, int64(i)), Direction: "RX"}
+		if err := writer.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	capture := buf.Bytes()
+	for n := 0; n <= len(capture); n++ {
+		readAllMessages(t, newPcapngReader(bytes.NewReader(capture[:n])))
+	}
+}
+
+func TestPcapngPacketLongerThanBlock(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newPcapngWriter(&buf)
+	msg := CANMessage{Frame: Frame{ID: 0x123, Length: 1}, Channel: "can0", Timestamp: time.Unix(1700000000, 0)}
+	if err := writer.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	// An enhanced packet block whose captured length exceeds the block
+	body := make([]byte, 20+16)
+	binary.LittleEndian.PutUint32(body[12:16], 1000)
+	block := binary.LittleEndian.AppendUint32(nil, pcapngEnhancedPacket)
+	block = binary.LittleEndian.AppendUint32(block, uint32(12+len(body)))
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, uint32(12+len(body)))
+
+	capture := append(buf.Bytes(), block...)
+	messages := readAllMessages(t, newPcapngReader(bytes.NewReader(capture)))
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+}
+
+func TestPcapngRoundTrip(t *testing.T) {
+	checkMessages(t, roundTripTrace(t, newPcapngWriter, newPcapngReader), traceTestMessages())
+}
+
+func TestPcapngInterfaceDescriptions(t *testing.T) {
+	// Interfaces keep bus URLs as names and timestamps in nanoseconds
+	start := time.Unix(1760655901, 123456789)
+	frame := Frame{ID: 0x123, Length: 1, Data: [64]byte{0x42}}
+	messages := []CANMessage{
+		{Frame: frame, Channel: "mem://demo", Timestamp: start, Direction: "RX"},
+		{Frame: frame, Channel: "can0", Timestamp: start.Add(1), Direction: "TX"},
+		{Frame: frame, Channel: "mem://demo", Timestamp: start.Add(2), Direction: "RX"},
+	}
+	trace := writeTrace(t, newPcapngWriter, messages)
+	if n := bytes.Count(trace, []byte("mem://demo")); n != 1 {
+		t.Errorf("interface described %d times, want once", n)
+	}
+	checkMessages(t, readAllMessages(t, newPcapngReader(bytes.NewReader(trace))), messages)
+}
+
+func TestPcapngUnknownInterface(t *testing.T) {
+	msg := CANMessage{Frame: Frame{ID: 0x123, Length: 1}, Channel: "can0", Timestamp: time.Unix(1700000000, 0)}
+	capture := writeTrace(t, newPcapngWriter, []CANMessage{msg})
+
+	// A packet of an interface that was never described
+	body := make([]byte, 20+CAN_MTU)
+	binary.LittleEndian.PutUint32(body[0:4], 7)
+	binary.LittleEndian.PutUint32(body[12:16], CAN_MTU)
+	binary.LittleEndian.PutUint32(body[16:20], CAN_MTU)
+	capture = binary.LittleEndian.AppendUint32(capture, pcapngEnhancedPacket)
+	capture = binary.LittleEndian.AppendUint32(capture, uint32(12+len(body)))
+	capture = append(capture, body...)
+	capture = binary.LittleEndian.AppendUint32(capture, uint32(12+len(body)))
+
+	capture = append(capture, writeTrace(t, newPcapngWriter, []CANMessage{msg})...)
+	expectReadError(t, newPcapngReader(bytes.NewReader(capture)))
+}
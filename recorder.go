@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// traceWriter writes CAN messages to a trace file in a specific format.
+type traceWriter interface {
+	// WriteMessage appends a message to the trace.
+	WriteMessage(msg CANMessage) error
+	// Close flushes buffered data and finishes the trace. It does not close
+	// the underlying file.
+	Close() error
+}
+
+// traceWriters maps recording formats to the writers of their trace format.
+// The format is also the file extension of the recording.
+var traceWriters = map[string]func(io.Writer) traceWriter{
+	"log":    newCandumpWriter,
+	"asc":    newASCWriter,
+	"trc":    newTRCWriter,
+	"pcapng": newPcapngWriter,
+	"mf4":    newMDFWriter,
+	"csv":    newCSVWriter,
+}
+
+// recorder writes every frame seen on the buses to a trace file.
+type recorder struct {
+	fileName string
+	file     *os.File
+	writer   traceWriter
+	frames   int
+	started  time.Time
+	failed   bool // A write failed, further messages are dropped
+}
+
+// recordingFileName returns the name of a new recording started at t.
+func recordingFileName(t time.Time, format string) string {
+	return fmt.Sprintf("nerdcan-%s.%s", t.Format("20060102-150405"), format)
+}
+
+// startRecording creates a new trace file of the given format in the current
+// directory.
+func startRecording(format string) (*recorder, error) {
+	newWriter, ok := traceWriters[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown recording format '%s'", format)
+	}
+	now := time.Now()
+	fileName := recordingFileName(now, format)
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{
+		fileName: fileName,
+		file:     file,
+		writer:   newWriter(file),
+		started:  now,
+	}, nil
+}
+
+// record appends a message to the recording.
+func (r *recorder) record(msg CANMessage) {
+	if r.failed {
+		return
+	}
+	if err := r.writer.WriteMessage(msg); err != nil {
+		Log(ERROR, "Writing to recording '%s' failed: %v", r.fileName, err)
+		r.failed = true
+		return
+	}
+	r.frames++
+}
+
+// stop finishes the recording and closes the file.
+func (r *recorder) stop() error {
+	err := r.writer.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceReader reads CAN messages from a trace file in a specific format.
+type traceReader interface {
+	// ReadMessage returns the next message of the trace, or io.EOF at its
+	// end. Errors wrapping errTraceRead end the trace, other errors report
+	// a broken entry that is skipped.
+	ReadMessage() (CANMessage, error)
+}
+
+// errTraceRead marks errors after which a trace can not be read any further,
+// such as I/O errors or lines too long for the scanner.
+var errTraceRead = errors.New("reading trace failed")
+
+// traceReaders maps file extensions to the readers of their trace format.
+var traceReaders = map[string]func(io.Reader) traceReader{
+	".log":    newCandumpReader,
+	".asc":    newASCReader,
+	".trc":    newTRCReader,
+	".pcapng": newPcapngReader,
+	".mf4":    newMDFReader,
+}
+
+// replaySpeeds are the replay speeds the speed can be cycled through. 0
+// replays as fast as possible.
+var replaySpeeds = []float64{0.5, 1, 10, 0}
+
+// replayControl is implemented by buses that replay recorded traffic and can
+// be controlled from the UI.
+type replayControl interface {
+	// Speed returns the replay speed, 0 means as fast as possible.
+	Speed() float64
+	SetSpeed(speed float64)
+	Paused() bool
+	SetPaused(paused bool)
+	// Step replays the next frame while paused.
+	Step()
+}
+
+// replayBusOptions configures the replay of a trace file.
+type replayBusOptions struct {
+	Speed float64 // Factor applied to the original timing, 0 for as fast as possible
+	Loop  bool    // Start over at the end of the file
+}
+
+// parseReplayBusOptions reads the options from the query of a file:// bus
+// URL, e.g. file://capture.log?speed=10&loop=1.
+func parseReplayBusOptions(query url.Values) (replayBusOptions, error) {
+	opts := replayBusOptions{Speed: 1}
+	if v := query.Get("speed"); v != "" {
+		if v == "max" {
+			opts.Speed = 0
+		} else {
+			speed, err := strconv.ParseFloat(v, 64)
+			if err != nil || speed <= 0 {
+				return opts, fmt.Errorf("invalid speed '%s'", v)
+			}
+			opts.Speed = speed
+		}
+	}
+	if v := query.Get("loop"); v != "" {
+		loop, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid loop flag '%s'", v)
+		}
+		opts.Loop = loop
+	}
+	return opts, nil
+}
+
+// replayBus is a receive-only Bus that replays a trace file with its
+// original timing.
+type replayBus struct {
+	path      string
+	newReader func(io.Reader) traceReader
+	loop      bool
+	rx        chan CANMessage
+
+	mu      sync.Mutex
+	speed   float64
+	paused  bool
+	changed chan struct{} // Signals the replay loop that speed or pause changed
+	step    chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newReplayBus(path string, opts replayBusOptions) (*replayBus, error) {
+	newReader, ok := traceReaders[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("unknown trace format '%s'", filepath.Ext(path))
+	}
+	return &replayBus{
+		path:      path,
+		newReader: newReader,
+		loop:      opts.Loop,
+		speed:     opts.Speed,
+		rx:        make(chan CANMessage),
+		changed:   make(chan struct{}, 1),
+		step:      make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}, nil
+}
+
+func (b *replayBus) Name() string {
+	return filepath.Base(b.path)
+}
+
+func (b *replayBus) Open(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Fail early if the file can not be read
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	go b.replay()
+	return nil
+}
+
+// replay delivers the messages of the file until its end, or forever when
+// looping.
+func (b *replayBus) replay() {
+	defer close(b.rx)
+
+	for {
+		delivered, err := b.replayFile()
+		if err != nil {
+			if !errors.Is(err, errReplayClosed) {
+				Log(ERROR, "Replaying '%s' failed: %v", b.path, err)
+			}
+			return
+		}
+		if !b.loop {
+			Log(INFO, "Replay of '%s' finished", b.path)
+			return
+		}
+		if delivered == 0 {
+			// Starting over would reopen the file in a busy loop
+			Log(WARNING, "Replay of '%s' stopped, the trace has no readable frames", b.path)
+			return
+		}
+	}
+}
+
+var errReplayClosed = errors.New("replay closed")
+
+// replayFile replays the file once and returns the number of delivered
+// messages.
+func (b *replayBus) replayFile() (int, error) {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := b.newReader(file)
+	var clock replayClock
+	delivered := 0
+	for {
+		msg, err := reader.ReadMessage()
+		if err == io.EOF {
+			return delivered, nil
+		}
+		if errors.Is(err, errTraceRead) {
+			return delivered, err
+		}
+		if err != nil {
+			Log(WARNING, "Skipping entry of '%s': %v", b.path, err)
+			continue
+		}
+		if err := b.wait(&clock, msg.Timestamp); err != nil {
+			return delivered, err
+		}
+		select {
+		case b.rx <- msg:
+			delivered++
+		case <-b.closed:
+			return delivered, errReplayClosed
+		}
+	}
+}
+
+// replayClock maps trace timestamps to wall clock times. It is rebased
+// whenever the speed changes or the replay is paused.
+type replayClock struct {
+	wall  time.Time // Wall clock time of the base
+	trace time.Time // Trace time of the base
+	last  time.Time // Trace time of the last delivered message
+}
+
+func (c *replayClock) rebase() {
+	c.wall = time.Now()
+	c.trace = c.last
+}
+
+// wait blocks until the message with the given trace timestamp is due.
+func (b *replayBus) wait(clock *replayClock, timestamp time.Time) error {
+	defer func() { clock.last = timestamp }()
+	if clock.last.IsZero() || timestamp.Before(clock.last) {
+		// First message, or the trace jumps back in time
+		clock.last = timestamp
+		clock.rebase()
+	}
+
+	for {
+		b.mu.Lock()
+		speed, paused := b.speed, b.paused
+		b.mu.Unlock()
+
+		if paused {
+			select {
+			case <-b.step:
+				clock.last = timestamp
+				clock.rebase()
+				return nil
+			case <-b.changed:
+				clock.rebase()
+				continue
+			case <-b.closed:
+				return errReplayClosed
+			}
+		}
+		if speed == 0 {
+			clock.last = timestamp
+			clock.rebase()
+			return nil
+		}
+
+		due := clock.wall.Add(time.Duration(float64(timestamp.Sub(clock.trace)) / speed))
+		wait := time.Until(due)
+		if wait <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			return nil
+		case <-b.changed:
+			timer.Stop()
+			clock.rebase()
+		case <-b.closed:
+			timer.Stop()
+			return errReplayClosed
+		}
+	}
+}
+
+func (b *replayBus) Receive() <-chan CANMessage {
+	return b.rx
+}
+
+func (b *replayBus) Transmit(ctx context.Context, frame Frame) error {
+	return fmt.Errorf("'%s' is a replayed trace, frames can not be sent", b.Name())
+}
+
+func (b *replayBus) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+	return nil
+}
+
+func (b *replayBus) Capabilities() BusCapabilities {
+	return BusCapabilities{FD: true, ErrorFrames: true}
+}
+
+// notify wakes the replay loop after a change of speed or pause.
+func (b *replayBus) notify() {
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (b *replayBus) Speed() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.speed
+}
+
+func (b *replayBus) SetSpeed(speed float64) {
+	b.mu.Lock()
+	b.speed = speed
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *replayBus) Paused() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.paused
+}
+
+func (b *replayBus) SetPaused(paused bool) {
+	b.mu.Lock()
+	b.paused = paused
+	b.mu.Unlock()
+	// Forget steps requested before the pause
+	select {
+	case <-b.step:
+	default:
+	}
+	b.notify()
+}
+
+func (b *replayBus) Step() {
+	select {
+	case b.step <- struct{}{}:
+	default:
+	}
+}
+
+// formatReplaySpeed renders a replay speed for the status bar, e.g. "10x".
+func formatReplaySpeed(speed float64) string {
+	if speed == 0 {
+		return "max"
+	}
+	return strconv.FormatFloat(speed, 'g', -1, 64) + "x"
+}
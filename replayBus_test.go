@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayAll opens a trace file as a replay bus and collects its messages
+// until the bus ends the stream.
+func replayAll(t *testing.T, path string, opts replayBusOptions) []CANMessage {
+	t.Helper()
+	bus, err := newReplayBus(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	var messages []CANMessage
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-bus.Receive():
+			if !ok {
+				return messages
+			}
+			messages = append(messages, msg)
+		case <-timeout:
+			t.Fatalf("replay of %s did not end, got %d messages", path, len(messages))
+		}
+	}
+}
+
+func TestReplaySkipsBrokenEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.log")
+	trace := "(1.000000) can0 123#01\n(2.000000) can0 12X#02\n(3.000000) can1 456#0304\n"
+	if err := os.WriteFile(path, []byte(trace), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := replayAll(t, path, replayBusOptions{Speed: 0})
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	if messages[1].Frame.ID != 0x456 {
+		t.Errorf("second message has ID 0x%X, want 0x456", messages[1].Frame.ID)
+	}
+}
+
+func TestReplayStopsOnReadError(t *testing.T) {
+	// A line longer than the scanner buffer is a sticky scanner error, the
+	// looping replay must end instead of retrying forever
+	path := filepath.Join(t.TempDir(), "long.log")
+	trace := "(1.000000) can0 123#01\n(2.000000) can0 123#" + strings.Repeat("0", 70*1024) + "\n(3.000000) can0 123#02\n"
+	if err := os.WriteFile(path, []byte(trace), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := replayAll(t, path, replayBusOptions{Speed: 0, Loop: true})
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+}
+
+func TestReplayLoopWithoutFrames(t *testing.T) {
+	// A looping replay of a trace without readable frames must end instead
+	// of reopening the file over and over
+	for name, trace := range map[string]string{
+		"empty":       "",
+		"all skipped": "(1.000000) can0 12X#01\n(2.000000) can0 123#0\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "trace.log")
+			if err := os.WriteFile(path, []byte(trace), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if messages := replayAll(t, path, replayBusOptions{Speed: 0, Loop: true}); len(messages) != 0 {
+				t.Errorf("got %d messages, want none", len(messages))
+			}
+		})
+	}
+}
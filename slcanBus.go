@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// slcanCommandTimeout is how long to wait for the adapter to answer a command.
+const slcanCommandTimeout = 500 * time.Millisecond
+
+// slcanBitrates maps CAN bitrates to the Sn setup command of the Lawicel
+// protocol.
+var slcanBitrates = map[int]string{
+	10000:   "S0",
+	20000:   "S1",
+	50000:   "S2",
+	100000:  "S3",
+	125000:  "S4",
+	250000:  "S5",
+	500000:  "S6",
+	800000:  "S7",
+	1000000: "S8",
+}
+
+// slcanBaudRates maps serial baud rates to their termios speed flags.
+var slcanBaudRates = map[int]uint32{
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	500000:  unix.B500000,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	2000000: unix.B2000000,
+	3000000: unix.B3000000,
+}
+
+// Bits of the status flags returned by the F command.
+const (
+	slcanStatusRxFifoFull = 0x01
+	slcanStatusTxFifoFull = 0x02
+	slcanStatusWarning    = 0x04
+	slcanStatusOverrun    = 0x08
+	slcanStatusPassive    = 0x20
+	slcanStatusLostArb    = 0x40
+	slcanStatusBusError   = 0x80
+)
+
+// slcanBell is the response of the adapter to a failed command.
+const slcanBell = "\a"
+
+var (
+	errSlcanRejected = errors.New("command rejected by adapter")
+	errSlcanTimeout  = errors.New("no response from adapter")
+)
+
+// slcanBusOptions configures an slcan adapter.
+type slcanBusOptions struct {
+	Bitrate    int           // CAN bitrate, one of slcanBitrates
+	Baud       int           // Serial baud rate, irrelevant for USB CDC adapters
+	ListenOnly bool          // Open the channel without ever acknowledging or sending frames
+	FD         bool          // The adapter sends and receives CAN FD frames (d, D, b and B)
+	Poll       time.Duration // Interval of the status flag polling, 0 disables it
+}
+
+// parseSlcanBusOptions reads the options from the query of an slcan:// bus
+// URL, e.g. slcan:///dev/ttyACM0?bitrate=500000&listen=1.
+func parseSlcanBusOptions(query url.Values) (slcanBusOptions, error) {
+	opts := slcanBusOptions{Bitrate: 500000, Baud: 115200, Poll: time.Second}
+	if v := query.Get("bitrate"); v != "" {
+		bitrate, err := strconv.Atoi(v)
+		if _, ok := slcanBitrates[bitrate]; err != nil || !ok {
+			return opts, fmt.Errorf("unsupported bitrate '%s'", v)
+		}
+		opts.Bitrate = bitrate
+	}
+	if v := query.Get("baud"); v != "" {
+		baud, err := strconv.Atoi(v)
+		if _, ok := slcanBaudRates[baud]; err != nil || !ok {
+			return opts, fmt.Errorf("unsupported baud rate '%s'", v)
+		}
+		opts.Baud = baud
+	}
+	if v := query.Get("listen"); v != "" {
+		listen, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid listen flag '%s'", v)
+		}
+		opts.ListenOnly = listen
+	}
+	if v := query.Get("fd"); v != "" {
+		fd, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid fd flag '%s'", v)
+		}
+		opts.FD = fd
+	}
+	if v := query.Get("poll"); v != "" {
+		poll, err := time.ParseDuration(v)
+		if err != nil || poll < 0 {
+			return opts, fmt.Errorf("invalid poll interval '%s'", v)
+		}
+		opts.Poll = poll
+	}
+	return opts, nil
+}
+
+// slcanBus is a Bus backed by a serial CAN adapter speaking the Lawicel
+// slcan ASCII protocol, without the kernel slcand daemon.
+type slcanBus struct {
+	device    string
+	opts      slcanBusOptions
+	file      *os.File
+	cmdMutex  sync.Mutex  // Serializes commands, the adapter answers them in order
+	responses chan string // Command responses read by the receive loop
+	rx        chan CANMessage
+	done      chan struct{} // Closed when the receive loop ends
+	closed    chan struct{}
+	closeOnce sync.Once
+	closing   atomic.Bool
+	clock     slcanClock
+}
+
+func newSlcanBus(device string, opts slcanBusOptions) *slcanBus {
+	return &slcanBus{
+		device:    device,
+		opts:      opts,
+		responses: make(chan string, 16),
+		// Buffered, so a busy receiver does not hold back command responses
+		rx:     make(chan CANMessage, canMsgBufferSize),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (b *slcanBus) Name() string {
+	return filepath.Base(b.device)
+}
+
+func (b *slcanBus) Open(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Non-blocking so the runtime poller handles the device and Close
+	// unblocks the receive loop
+	file, err := os.OpenFile(b.device, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	if err := configureSerial(file, slcanBaudRates[b.opts.Baud]); err != nil {
+		file.Close()
+		return fmt.Errorf("configure %s: %w", b.device, err)
+	}
+	b.file = file
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.receive()
+	}()
+	go func() {
+		wg.Wait()
+		close(b.rx)
+	}()
+
+	// Close a channel left open by an earlier session, the adapter rejects
+	// the setup commands otherwise
+	b.command("C")
+	if _, err := b.command(slcanBitrates[b.opts.Bitrate]); err != nil {
+		b.Close()
+		return fmt.Errorf("set bitrate %d: %w", b.opts.Bitrate, err)
+	}
+	if _, err := b.command("Z1"); err != nil {
+		Log(WARNING, "Adapter '%s' does not support timestamps: %v", b.device, err)
+	}
+	open := "O"
+	if b.opts.ListenOnly {
+		open = "L"
+	}
+	if _, err := b.command(open); err != nil {
+		b.Close()
+		return fmt.Errorf("open channel: %w", err)
+	}
+
+	if b.opts.Poll > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.pollStatus()
+		}()
+	}
+	return nil
+}
+
+// configureSerial puts the serial device in raw mode with the given speed.
+func configureSerial(file *os.File, speed uint32) error {
+	rawConn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var termErr error
+	err = rawConn.Control(func(fd uintptr) {
+		t, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if err != nil {
+			termErr = err
+			return
+		}
+		// Equivalent of cfmakeraw(3)
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CBAUD
+		t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | speed
+		t.Cc[unix.VMIN] = 1
+		t.Cc[unix.VTIME] = 0
+		termErr = unix.IoctlSetTermios(int(fd), unix.TCSETS, t)
+	})
+	if err != nil {
+		return err
+	}
+	return termErr
+}
+
+// receive reads lines from the adapter until the device is closed. Frames
+// are forwarded to the receive channel, everything else is a response to the
+// last command.
+func (b *slcanBus) receive() {
+	defer close(b.done)
+
+	buf := make([]byte, 256)
+	var line []byte
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			if !b.closing.Load() {
+				Log(ERROR, "Receiving from slcan adapter '%s' failed: %v", b.device, err)
+			}
+			return
+		}
+		for _, c := range buf[:n] {
+			switch c {
+			case '\r':
+				b.handleLine(string(line))
+				line = line[:0]
+			case '\a':
+				b.respond(slcanBell)
+				line = line[:0]
+			case '\n':
+			default:
+				line = append(line, c)
+			}
+		}
+	}
+}
+
+// handleLine dispatches a line received from the adapter.
+func (b *slcanBus) handleLine(line string) {
+	if len(line) > 1 && strings.ContainsRune("tTrRdDbB", rune(line[0])) {
+		frame, stamp, hasStamp, err := decodeSlcanFrame(line)
+		if err != nil {
+			Log(WARNING, "Ignoring malformed slcan frame '%s': %v", line, err)
+			return
+		}
+		msg := CANMessage{Frame: frame, Timestamp: time.Now(), TimestampSource: TimestampUser, Direction: "RX", SentByApp: false}
+		if hasStamp {
+			msg.Timestamp = b.clock.timestamp(stamp, msg.Timestamp)
+			msg.TimestampSource = TimestampHardware
+		}
+		select {
+		case b.rx <- msg:
+		case <-b.closed:
+		}
+		return
+	}
+	b.respond(line)
+}
+
+// respond hands a response to a waiting command. Responses nobody waits for
+// are dropped.
+func (b *slcanBus) respond(response string) {
+	select {
+	case b.responses <- response:
+	default:
+	}
+}
+
+// command sends a command to the adapter and waits for its response.
+func (b *slcanBus) command(cmd string) (string, error) {
+	b.cmdMutex.Lock()
+	defer b.cmdMutex.Unlock()
+
+	// Drop responses to earlier commands that timed out
+	for len(b.responses) > 0 {
+		<-b.responses
+	}
+	if _, err := b.file.WriteString(cmd + "\r"); err != nil {
+		return "", err
+	}
+
+	timeout := time.NewTimer(slcanCommandTimeout)
+	defer timeout.Stop()
+	select {
+	case response := <-b.responses:
+		if response == slcanBell {
+			return "", errSlcanRejected
+		}
+		return response, nil
+	case <-timeout.C:
+		return "", errSlcanTimeout
+	case <-b.done:
+		return "", fmt.Errorf("adapter '%s' is closed", b.device)
+	}
+}
+
+// pollStatus periodically reads the status flags of the adapter and reports
+// set flags as error frames.
+func (b *slcanBus) pollStatus() {
+	ticker := time.NewTicker(b.opts.Poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			response, err := b.command("F")
+			if err != nil || !strings.HasPrefix(response, "F") {
+				continue
+			}
+			flags, err := strconv.ParseUint(response[1:], 16, 8)
+			if err != nil || flags == 0 {
+				continue
+			}
+			select {
+			case b.rx <- CANMessage{Frame: slcanStatusErrorFrame(uint8(flags)), Timestamp: time.Now(), TimestampSource: TimestampUser, Direction: "RX", SentByApp: false}:
+			case <-b.closed:
+				return
+			}
+		case <-b.closed:
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// slcanStatusErrorFrame translates the status flags of the adapter into an
+// error frame.
+func slcanStatusErrorFrame(flags uint8) Frame {
+	frame := Frame{Length: CAN_ERR_DLC, IsError: true}
+	if flags&(slcanStatusRxFifoFull|slcanStatusTxFifoFull|slcanStatusOverrun|slcanStatusWarning|slcanStatusPassive) != 0 {
+		frame.ID |= CAN_ERR_CRTL
+	}
+	if flags&(slcanStatusRxFifoFull|slcanStatusOverrun) != 0 {
+		frame.Data[1] |= CAN_ERR_CRTL_RX_OVERFLOW
+	}
+	if flags&slcanStatusTxFifoFull != 0 {
+		frame.Data[1] |= CAN_ERR_CRTL_TX_OVERFLOW
+	}
+	if flags&slcanStatusWarning != 0 {
+		frame.Data[1] |= CAN_ERR_CRTL_RX_WARNING | CAN_ERR_CRTL_TX_WARNING
+	}
+	if flags&slcanStatusPassive != 0 {
+		frame.Data[1] |= CAN_ERR_CRTL_RX_PASSIVE | CAN_ERR_CRTL_TX_PASSIVE
+	}
+	if flags&slcanStatusLostArb != 0 {
+		frame.ID |= CAN_ERR_LOSTARB
+	}
+	if flags&slcanStatusBusError != 0 {
+		frame.ID |= CAN_ERR_BUSERROR
+	}
+	return frame
+}
+
+func (b *slcanBus) Receive() <-chan CANMessage {
+	return b.rx
+}
+
+func (b *slcanBus) Transmit(ctx context.Context, frame Frame) error {
+	if b.file == nil {
+		return fmt.Errorf("adapter '%s' is not open", b.device)
+	}
+	if b.opts.ListenOnly {
+		return fmt.Errorf("adapter '%s' is open in listen-only mode", b.device)
+	}
+	if frame.IsFD && !b.opts.FD {
+		return fmt.Errorf("CAN FD is not enabled for adapter '%s', see fd=1", b.device)
+	}
+	if err := frame.Validate(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := b.command(encodeSlcanFrame(frame))
+	return err
+}
+
+func (b *slcanBus) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	var err error
+	b.closeOnce.Do(func() {
+		// Take the adapter off the bus before releasing the device
+		b.command("C")
+		b.closing.Store(true)
+		close(b.closed)
+		err = b.file.Close()
+	})
+	return err
+}
+
+func (b *slcanBus) Capabilities() BusCapabilities {
+	return BusCapabilities{Transmit: !b.opts.ListenOnly, FD: b.opts.FD, ErrorFrames: b.opts.Poll > 0}
+}
+
+// encodeSlcanFrame encodes a frame as slcan transmit command, e.g.
+// "t1232DEAD" or "R123456780". CAN FD frames use the d and D commands, or b
+// and B with bit rate switch, and their DLC code.
+func encodeSlcanFrame(frame Frame) string {
+	var b strings.Builder
+	switch {
+	case frame.IsFD && frame.BRS && frame.IsExtended:
+		fmt.Fprintf(&b, "B%08X", frame.ID)
+	case frame.IsFD && frame.BRS:
+		fmt.Fprintf(&b, "b%03X", frame.ID)
+	case frame.IsFD && frame.IsExtended:
+		fmt.Fprintf(&b, "D%08X", frame.ID)
+	case frame.IsFD:
+		fmt.Fprintf(&b, "d%03X", frame.ID)
+	case frame.IsRemote && frame.IsExtended:
+		fmt.Fprintf(&b, "R%08X", frame.ID)
+	case frame.IsRemote:
+		fmt.Fprintf(&b, "r%03X", frame.ID)
+	case frame.IsExtended:
+		fmt.Fprintf(&b, "T%08X", frame.ID)
+	default:
+		fmt.Fprintf(&b, "t%03X", frame.ID)
+	}
+	fmt.Fprintf(&b, "%X", frame.DLC())
+	if !frame.IsRemote {
+		fmt.Fprintf(&b, "%X", frame.Payload())
+	}
+	return b.String()
+}
+
+// decodeSlcanFrame decodes a frame received from the adapter. The frame may
+// be followed by a timestamp in milliseconds, which the adapter wraps after
+// one minute.
+func decodeSlcanFrame(line string) (frame Frame, stamp uint16, hasStamp bool, err error) {
+	idLength := 3
+	switch line[0] {
+	case 'T':
+		frame.IsExtended = true
+		idLength = 8
+	case 'r':
+		frame.IsRemote = true
+	case 'R':
+		frame.IsExtended = true
+		frame.IsRemote = true
+		idLength = 8
+	case 'd':
+		frame.IsFD = true
+	case 'D':
+		frame.IsFD = true
+		frame.IsExtended = true
+		idLength = 8
+	case 'b':
+		frame.IsFD = true
+		frame.BRS = true
+	case 'B':
+		frame.IsFD = true
+		frame.BRS = true
+		frame.IsExtended = true
+		idLength = 8
+	}
+	if len(line) < 1+idLength+1 {
+		return frame, 0, false, fmt.Errorf("too short")
+	}
+
+	id, err := strconv.ParseUint(line[1:1+idLength], 16, 32)
+	if err != nil {
+		return frame, 0, false, fmt.Errorf("invalid ID")
+	}
+	frame.ID = uint32(id)
+	dlc, err := strconv.ParseUint(line[1+idLength:2+idLength], 16, 8)
+	if err != nil || (!frame.IsFD && dlc > CAN_MAX_DLEN) {
+		return frame, 0, false, fmt.Errorf("invalid DLC")
+	}
+	frame.Length = uint8(dlc)
+	if frame.IsFD {
+		frame.Length = fdDLCToLength(uint8(dlc))
+	}
+	length := int(frame.Length)
+
+	rest := line[2+idLength:]
+	if !frame.IsRemote {
+		if len(rest) < 2*length {
+			return frame, 0, false, fmt.Errorf("too short")
+		}
+		for i := 0; i < length; i++ {
+			v, err := strconv.ParseUint(rest[2*i:2*i+2], 16, 8)
+			if err != nil {
+				return frame, 0, false, fmt.Errorf("invalid data")
+			}
+			frame.Data[i] = byte(v)
+		}
+		rest = rest[2*length:]
+	}
+	if err := frame.Validate(); err != nil {
+		return frame, 0, false, err
+	}
+
+	if len(rest) == 4 {
+		v, err := strconv.ParseUint(rest, 16, 16)
+		if err == nil && v < 60000 {
+			return frame, uint16(v), true, nil
+		}
+	}
+	return frame, 0, false, nil
+}
+
+// slcanClock turns the millisecond timestamps of an slcan adapter, which wrap
+// every minute, into absolute times. It follows the adapter clock and only
+// resynchronizes to the host clock when both drift apart.
+type slcanClock struct {
+	last      time.Time
+	lastStamp uint16
+}
+
+func (c *slcanClock) timestamp(stamp uint16, now time.Time) time.Time {
+	if !c.last.IsZero() {
+		delta := (int(stamp) - int(c.lastStamp) + 60000) % 60000
+		t := c.last.Add(time.Duration(delta) * time.Millisecond)
+		if diff := now.Sub(t); diff > -time.Second && diff < time.Second {
+			c.last, c.lastStamp = t, stamp
+			return t
+		}
+	}
+	c.last, c.lastStamp = now, stamp
+	return now
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fakeSlcanAdapter is the adapter end of a pseudo terminal. It answers the
+// commands of an slcanBus like a Lawicel adapter and records them.
+type fakeSlcanAdapter struct {
+	pty      *os.File
+	device   string          // Terminal opened by the bus
+	commands chan string     // Commands received from the bus
+	reject   map[string]bool // Commands answered with BEL
+}
+
+func newFakeSlcanAdapter(t *testing.T, reject ...string) *fakeSlcanAdapter {
+	t.Helper()
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(fd)
+		t.Fatalf("unlock pseudo terminal: %v", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		t.Fatalf("get pseudo terminal number: %v", err)
+	}
+
+	a := &fakeSlcanAdapter{
+		pty:      os.NewFile(uintptr(fd), "/dev/ptmx"),
+		device:   fmt.Sprintf("/dev/pts/%d", n),
+		commands: make(chan string, 64),
+		reject:   make(map[string]bool),
+	}
+	for _, cmd := range reject {
+		a.reject[cmd] = true
+	}
+	go a.serve()
+	t.Cleanup(func() { a.pty.Close() })
+	return a
+}
+
+// serve answers the commands of the bus until the pseudo terminal is closed.
+func (a *fakeSlcanAdapter) serve() {
+	buf := make([]byte, 256)
+	var cmd []byte
+	for {
+		n, err := a.pty.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, c := range buf[:n] {
+			if c != '\r' {
+				cmd = append(cmd, c)
+				continue
+			}
+			select {
+			case a.commands <- string(cmd):
+			default:
+			}
+			a.pty.WriteString(a.response(string(cmd)))
+			cmd = cmd[:0]
+		}
+	}
+}
+
+// response returns the answer of an adapter to a command.
+func (a *fakeSlcanAdapter) response(cmd string) string {
+	switch {
+	case cmd == "" || a.reject[cmd]:
+		return slcanBell
+	case strings.ContainsAny(cmd[:1], "trdb"):
+		return "z\r"
+	case strings.ContainsAny(cmd[:1], "TRDB"):
+		return "Z\r"
+	case cmd == "F":
+		return "F00\r"
+	}
+	return "\r"
+}
+
+// send delivers a line to the bus as if it came from the CAN bus.
+func (a *fakeSlcanAdapter) send(t *testing.T, line string) {
+	t.Helper()
+	if _, err := a.pty.WriteString(line + "\r"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expect checks the next commands received from the bus.
+func (a *fakeSlcanAdapter) expect(t *testing.T, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case cmd := <-a.commands:
+			if cmd != w {
+				t.Fatalf("got command %q, want %q", cmd, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no command received, want %q", w)
+		}
+	}
+}
+
+// openSlcanBus opens an slcan bus on the adapter with the given options and
+// closes it at the end of the test.
+func openSlcanBus(t *testing.T, a *fakeSlcanAdapter, query string) (Bus, error) {
+	t.Helper()
+	bus, err := newBus("slcan://" + a.device + "?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Open(context.Background()); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus, nil
+}
+
+func TestSlcanFrameCodec(t *testing.T) {
+	tests := []struct {
+		line  string
+		frame Frame
+	}{
+		{"t1232DEAD", Frame{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}},
+		{"t7FF0", Frame{ID: 0x7FF}},
+		{"T1ABCDEF080102030405060708", Frame{ID: 0x1ABCDEF0, Length: 8, Data: [64]byte{1, 2, 3, 4, 5, 6, 7, 8}, IsExtended: true}},
+		{"r1004", Frame{ID: 0x100, Length: 4, IsRemote: true}},
+		{"R000000010", Frame{ID: 0x1, IsExtended: true, IsRemote: true}},
+		{"d1239000102030405060708090A0B", Frame{ID: 0x123, Length: 12, Data: [64]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, IsFD: true}},
+		{"D123456781AA", Frame{ID: 0x12345678, Length: 1, Data: [64]byte{0xAA}, IsExtended: true, IsFD: true}},
+		{"b0012BEEF", Frame{ID: 0x1, Length: 2, Data: [64]byte{0xBE, 0xEF}, IsFD: true, BRS: true}},
+		{"B1FFFFFFF0", Frame{ID: 0x1FFFFFFF, IsExtended: true, IsFD: true, BRS: true}},
+	}
+	for _, tt := range tests {
+		if got := encodeSlcanFrame(tt.frame); got != tt.line {
+			t.Errorf("encode %v = %q, want %q", tt.frame, got, tt.line)
+		}
+		frame, _, hasStamp, err := decodeSlcanFrame(tt.line)
+		if err != nil || frame != tt.frame || hasStamp {
+			t.Errorf("decode %q = %v, %v, %v, want %v", tt.line, frame, hasStamp, err, tt.frame)
+		}
+	}
+}
+
+func TestDecodeSlcanFrameTimestamp(t *testing.T) {
+	frame, stamp, hasStamp, err := decodeSlcanFrame("t1231AAEA5F")
+	if err != nil || !hasStamp || stamp != 0xEA5F || frame.Payload()[0] != 0xAA {
+		t.Errorf("got %v, stamp %d %v, %v", frame, stamp, hasStamp, err)
+	}
+	// The adapter wraps its timestamps after 60000ms
+	if _, _, hasStamp, _ := decodeSlcanFrame("t1231AAEA60"); hasStamp {
+		t.Error("timestamp 60000 accepted")
+	}
+}
+
+func TestDecodeSlcanFrameMalformed(t *testing.T) {
+	for _, line := range []string{
+		"t12",         // Too short for an ID and DLC
+		"t12X1AA",     // Invalid ID
+		"t1239AABBCC", // Classic frames carry at most 8 bytes
+		"t123GAA",     // Invalid DLC
+		"t1232AA",     // Less data than the DLC
+		"t1231ZZ",     // Invalid data
+		"T200000000",  // ID exceeds 29 bits
+		"d123A00",     // Less data than the FD DLC code
+	} {
+		if frame, _, _, err := decodeSlcanFrame(line); err == nil {
+			t.Errorf("decode %q = %v, want an error", line, frame)
+		}
+	}
+}
+
+func TestSlcanBusRoundTrip(t *testing.T) {
+	adapter := newFakeSlcanAdapter(t)
+	bus, err := openSlcanBus(t, adapter, "bitrate=250000&poll=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.expect(t, "C", "S5", "Z1", "O")
+
+	frames := []Frame{
+		{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}},
+		{ID: 0x18FEF100, Length: 1, Data: [64]byte{0x42}, IsExtended: true},
+		{ID: 0x321, Length: 8, IsRemote: true},
+	}
+	for _, frame := range frames {
+		if err := bus.Transmit(context.Background(), frame); err != nil {
+			t.Fatalf("transmit %v: %v", frame, err)
+		}
+		adapter.expect(t, encodeSlcanFrame(frame))
+	}
+	if err := bus.Transmit(context.Background(), Frame{ID: 0x1, Length: 12, IsFD: true}); err == nil {
+		t.Error("CAN FD frame sent without fd=1")
+	}
+
+	adapter.send(t, "T18FEF1002BEEF")
+	msg := nextMessage(t, bus.Receive())
+	want := Frame{ID: 0x18FEF100, Length: 2, Data: [64]byte{0xBE, 0xEF}, IsExtended: true}
+	if msg.Frame != want || msg.Direction != "RX" || msg.TimestampSource != TimestampUser {
+		t.Errorf("received %v %s %s, want %v RX without timestamp", msg.Frame, msg.Direction, msg.TimestampSource, want)
+	}
+	adapter.send(t, "t1230EA5F")
+	if msg := nextMessage(t, bus.Receive()); msg.TimestampSource != TimestampHardware {
+		t.Errorf("timestamp source = %s, want %s", msg.TimestampSource, TimestampHardware)
+	}
+}
+
+func TestSlcanBusFD(t *testing.T) {
+	adapter := newFakeSlcanAdapter(t)
+	bus, err := openSlcanBus(t, adapter, "fd=1&poll=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.expect(t, "C", "S6", "Z1", "O")
+	if !bus.Capabilities().FD {
+		t.Error("bus opened with fd=1 does not report CAN FD")
+	}
+
+	frame := Frame{ID: 0x123, Length: 16, IsFD: true, BRS: true}
+	frame.Data[15] = 0xFF
+	if err := bus.Transmit(context.Background(), frame); err != nil {
+		t.Fatalf("transmit %v: %v", frame, err)
+	}
+	adapter.expect(t, "b123A"+strings.Repeat("00", 15)+"FF")
+
+	adapter.send(t, "D000007FF1AA")
+	want := Frame{ID: 0x7FF, Length: 1, Data: [64]byte{0xAA}, IsExtended: true, IsFD: true}
+	if msg := nextMessage(t, bus.Receive()); msg.Frame != want {
+		t.Errorf("received %v, want %v", msg.Frame, want)
+	}
+}
+
+func TestSlcanBusListenOnly(t *testing.T) {
+	adapter := newFakeSlcanAdapter(t)
+	bus, err := openSlcanBus(t, adapter, "listen=1&poll=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.expect(t, "C", "S6", "Z1", "L")
+	if err := bus.Transmit(context.Background(), Frame{ID: 0x1}); err == nil {
+		t.Error("frame sent in listen-only mode")
+	}
+}
+
+func TestSlcanBusRejectedCommands(t *testing.T) {
+	t.Run("bitrate", func(t *testing.T) {
+		adapter := newFakeSlcanAdapter(t, "S8")
+		if _, err := openSlcanBus(t, adapter, "bitrate=1000000&poll=0"); !errors.Is(err, errSlcanRejected) {
+			t.Fatalf("open error = %v, want %v", err, errSlcanRejected)
+		}
+		adapter.expect(t, "C", "S8")
+	})
+	t.Run("timestamps", func(t *testing.T) {
+		// Adapters without timestamps are still usable
+		adapter := newFakeSlcanAdapter(t, "Z1")
+		if _, err := openSlcanBus(t, adapter, "poll=0"); err != nil {
+			t.Fatal(err)
+		}
+		adapter.expect(t, "C", "S6", "Z1", "O")
+	})
+	t.Run("transmit", func(t *testing.T) {
+		adapter := newFakeSlcanAdapter(t, "t0011FF")
+		bus, err := openSlcanBus(t, adapter, "poll=0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bus.Transmit(context.Background(), Frame{ID: 0x1, Length: 1, Data: [64]byte{0xFF}}); !errors.Is(err, errSlcanRejected) {
+			t.Errorf("transmit error = %v, want %v", err, errSlcanRejected)
+		}
+		if err := bus.Transmit(context.Background(), Frame{ID: 0x2}); err != nil {
+			t.Errorf("transmit after a rejected command: %v", err)
+		}
+	})
+}
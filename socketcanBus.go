@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SocketCAN frame sizes as defined in linux/can.h.
+const (
+	CAN_MTU   = 16 // struct can_frame
+	CANFD_MTU = 72 // struct canfd_frame
+)
+
+// CAN FD frame flags as defined in linux/can.h.
+const (
+	CANFD_BRS = 0x01 // Bit rate switch
+	CANFD_ESI = 0x02 // Error state indicator
+	CANFD_FDF = 0x04 // Frame is a CAN FD frame
+)
+
+// rxTimestampFlags requests software and, where the driver provides them,
+// hardware receive timestamps from the kernel.
+const rxTimestampFlags = unix.SOF_TIMESTAMPING_RX_SOFTWARE | unix.SOF_TIMESTAMPING_SOFTWARE |
+	unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE
+
+// socketcanBus is a Bus backed by a Linux SocketCAN interface. It owns a
+// single long-lived raw socket per interface that is shared by the receive
+// loop and all send jobs.
+type socketcanBus struct {
+	device      string
+	file        *os.File
+	fd          bool       // The interface and the socket accept CAN FD frames
+	errorFrames bool       // The socket receives error frames
+	txMutex     sync.Mutex // Serializes writes of concurrent send jobs
+	rx          chan CANMessage
+	closing     atomic.Bool
+}
+
+func newSocketcanBus(device string) *socketcanBus {
+	return &socketcanBus{
+		device: device,
+		rx:     make(chan CANMessage),
+	}
+}
+
+func (b *socketcanBus) Name() string {
+	return b.device
+}
+
+func (b *socketcanBus) Open(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ifi, err := net.InterfaceByName(b.device)
+	if err != nil {
+		return fmt.Errorf("interface %s: %w", b.device, err)
+	}
+
+	sock, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW, unix.CAN_RAW)
+	if err != nil {
+		return fmt.Errorf("socket: %w", err)
+	}
+
+	// An interface with the CAN FD MTU accepts FD frames, classic frames are
+	// still delivered on an FD enabled socket
+	if ifi.MTU == CANFD_MTU {
+		if err := unix.SetsockoptInt(sock, unix.SOL_CAN_RAW, unix.CAN_RAW_FD_FRAMES, 1); err != nil {
+			Log(WARNING, "Failed to enable CAN FD on '%s': %v", b.device, err)
+		} else {
+			b.fd = true
+		}
+	}
+
+	// Subscribe to all error frames the controller reports
+	if err := unix.SetsockoptInt(sock, unix.SOL_CAN_RAW, unix.CAN_RAW_ERR_FILTER, CAN_ERR_MASK); err != nil {
+		Log(WARNING, "Failed to receive error frames on '%s': %v", b.device, err)
+	} else {
+		b.errorFrames = true
+	}
+
+	// Let the kernel stamp frames on reception, so the time spent in the
+	// application does not end up in the measured cycle times
+	if err := unix.SetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, rxTimestampFlags); err != nil {
+		if err := unix.SetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+			Log(WARNING, "Kernel timestamps are not available on '%s': %v", b.device, err)
+		}
+	}
+
+	// Put the socket in non-blocking mode so the runtime poller handles it
+	if err := unix.SetNonblock(sock, true); err != nil {
+		unix.Close(sock)
+		return fmt.Errorf("set nonblock: %w", err)
+	}
+	if err := unix.Bind(sock, &unix.SockaddrCAN{Ifindex: ifi.Index}); err != nil {
+		unix.Close(sock)
+		return fmt.Errorf("bind: %w", err)
+	}
+	b.file = os.NewFile(uintptr(sock), b.device)
+
+	go b.receive()
+	return nil
+}
+
+// receive forwards frames from the socket to the receive channel until the
+// socket is closed.
+func (b *socketcanBus) receive() {
+	defer close(b.rx)
+
+	rawConn, err := b.file.SyscallConn()
+	if err != nil {
+		Log(ERROR, "Receiving from CAN interface '%s' failed: %v", b.device, err)
+		return
+	}
+
+	buf := make([]byte, CANFD_MTU)
+	// Room for struct scm_timestamping, which holds three timespecs
+	oob := make([]byte, unix.CmsgSpace(3*int(unsafe.Sizeof(unix.Timespec{}))))
+	for {
+		var n, oobn int
+		var recvErr error
+		err := rawConn.Read(func(fd uintptr) bool {
+			n, oobn, _, _, recvErr = unix.Recvmsg(int(fd), buf, oob, 0)
+			return !errors.Is(recvErr, unix.EAGAIN)
+		})
+		if err == nil {
+			err = recvErr
+		}
+		if err != nil {
+			if !b.closing.Load() {
+				Log(ERROR, "Receiving from CAN interface '%s' failed: %v", b.device, err)
+			}
+			return
+		}
+		if n != CAN_MTU && n != CANFD_MTU {
+			continue
+		}
+
+		timestamp, source := rxTimestamp(oob[:oobn])
+		b.rx <- CANMessage{Frame: unmarshalSocketcanFrame(buf[:n]), Timestamp: timestamp, TimestampSource: source, Direction: "RX", SentByApp: false}
+	}
+}
+
+// rxTimestamp extracts the most accurate receive timestamp from the control
+// messages of a received frame. Without kernel timestamps it falls back to
+// the current time.
+func rxTimestamp(oob []byte) (time.Time, string) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Now(), TimestampUser
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level != unix.SOL_SOCKET {
+			continue
+		}
+		switch msg.Header.Type {
+		case unix.SCM_TIMESTAMPING:
+			// ts[0] is the software, ts[2] the raw hardware timestamp
+			ts := parseTimespecs(msg.Data)
+			if len(ts) == 3 && !ts[2].IsZero() {
+				return ts[2], TimestampHardware
+			}
+			if len(ts) > 0 && !ts[0].IsZero() {
+				return ts[0], TimestampKernel
+			}
+		case unix.SCM_TIMESTAMPNS:
+			if ts := parseTimespecs(msg.Data); len(ts) > 0 {
+				return ts[0], TimestampKernel
+			}
+		}
+	}
+	return time.Now(), TimestampUser
+}
+
+// parseTimespecs decodes consecutive struct timespec values. Unset values
+// become the zero time.
+func parseTimespecs(b []byte) []time.Time {
+	size := int(unsafe.Sizeof(unix.Timespec{}))
+	var times []time.Time
+	for ; len(b) >= size; b = b[size:] {
+		ts := *(*unix.Timespec)(unsafe.Pointer(&b[0]))
+		if ts.Sec == 0 && ts.Nsec == 0 {
+			times = append(times, time.Time{})
+			continue
+		}
+		times = append(times, time.Unix(ts.Unix()))
+	}
+	return times
+}
+
+func (b *socketcanBus) Receive() <-chan CANMessage {
+	return b.rx
+}
+
+func (b *socketcanBus) Transmit(ctx context.Context, frame Frame) error {
+	if b.file == nil {
+		return fmt.Errorf("CAN interface '%s' is not open", b.device)
+	}
+	if frame.IsFD && !b.fd {
+		return fmt.Errorf("CAN interface '%s' does not support CAN FD", b.device)
+	}
+	if err := frame.Validate(); err != nil {
+		return err
+	}
+
+	b.txMutex.Lock()
+	defer b.txMutex.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := b.file.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	_, err := b.file.Write(marshalSocketcanFrame(frame))
+	return err
+}
+
+func (b *socketcanBus) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.closing.Store(true)
+	return b.file.Close()
+}
+
+func (b *socketcanBus) Capabilities() BusCapabilities {
+	return BusCapabilities{Transmit: true, FD: b.fd, ErrorFrames: b.errorFrames}
+}
+
+// unmarshalSocketcanFrame decodes a struct can_frame or struct canfd_frame
+// depending on the length of b.
+func unmarshalSocketcanFrame(b []byte) Frame {
+	idAndFlags := binary.NativeEndian.Uint32(b[0:4])
+	if idAndFlags&CAN_ERR_FLAG != 0 {
+		frame := Frame{ID: idAndFlags & CAN_ERR_MASK, Length: CAN_ERR_DLC, IsError: true}
+		copy(frame.Data[:CAN_ERR_DLC], b[8:])
+		return frame
+	}
+	frame := Frame{
+		Length:     b[4],
+		IsExtended: idAndFlags&unix.CAN_EFF_FLAG != 0,
+		IsRemote:   idAndFlags&unix.CAN_RTR_FLAG != 0,
+	}
+	if frame.IsExtended {
+		frame.ID = idAndFlags & unix.CAN_EFF_MASK
+	} else {
+		frame.ID = idAndFlags & unix.CAN_SFF_MASK
+	}
+
+	maxLength := uint8(CAN_MAX_DLEN)
+	if len(b) == CANFD_MTU {
+		frame.IsFD = true
+		frame.BRS = b[5]&CANFD_BRS != 0
+		frame.ESI = b[5]&CANFD_ESI != 0
+		maxLength = CANFD_MAX_DLEN
+	}
+	if frame.Length > maxLength {
+		frame.Length = maxLength
+	}
+	copy(frame.Data[:], b[8:])
+	return frame
+}
+
+// marshalSocketcanFrame encodes a frame as struct can_frame, or as struct
+// canfd_frame for CAN FD frames.
+func marshalSocketcanFrame(frame Frame) []byte {
+	idAndFlags := frame.ID
+	if frame.IsExtended {
+		idAndFlags |= unix.CAN_EFF_FLAG
+	}
+	if frame.IsRemote {
+		idAndFlags |= unix.CAN_RTR_FLAG
+	}
+
+	size := CAN_MTU
+	if frame.IsFD {
+		size = CANFD_MTU
+	}
+	b := make([]byte, size)
+	binary.NativeEndian.PutUint32(b[0:4], idAndFlags)
+	b[4] = frame.Length
+	if frame.IsFD {
+		b[5] = CANFD_FDF
+		if frame.BRS {
+			b[5] |= CANFD_BRS
+		}
+		if frame.ESI {
+			b[5] |= CANFD_ESI
+		}
+	}
+	copy(b[8:], frame.Data[:size-8])
+	return b
+}
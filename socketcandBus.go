@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// socketcandDefaultPort is the TCP port socketcand listens on by default.
+const socketcandDefaultPort = "29536"
+
+// socketcandDialTimeout limits connecting and the handshake with the server.
+const socketcandDialTimeout = 5 * time.Second
+
+// socketcandBus is a Bus backed by a CAN interface exported by a socketcand
+// server over TCP. The connection is switched to raw mode, in which the
+// server forwards every frame of the interface and sends the frames it is
+// given.
+type socketcandBus struct {
+	address string // host:port of the server
+	channel string // CAN interface on the server
+	conn    net.Conn
+	reader  *bufio.Reader
+	txMutex sync.Mutex // Serializes writes of concurrent send jobs
+	rx      chan CANMessage
+	closing atomic.Bool
+}
+
+func newSocketcandBus(address, channel string) *socketcandBus {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, socketcandDefaultPort)
+	}
+	return &socketcandBus{
+		address: address,
+		channel: channel,
+		rx:      make(chan CANMessage),
+	}
+}
+
+func (b *socketcandBus) Name() string {
+	host, _, _ := net.SplitHostPort(b.address)
+	return b.channel + "@" + host
+}
+
+func (b *socketcandBus) Open(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, socketcandDialTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", b.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	b.conn = conn
+	b.reader = bufio.NewReader(conn)
+
+	if err := b.handshake(); err != nil {
+		conn.Close()
+		return fmt.Errorf("socketcand %s: %w", b.address, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	go b.receive()
+	return nil
+}
+
+// handshake opens the CAN interface on the server and enters raw mode.
+func (b *socketcandBus) handshake() error {
+	if err := b.expect("hi"); err != nil {
+		return err
+	}
+	if err := b.writeCommand("open " + b.channel); err != nil {
+		return err
+	}
+	if err := b.expect("ok"); err != nil {
+		return fmt.Errorf("open %s: %w", b.channel, err)
+	}
+	if err := b.writeCommand("rawmode"); err != nil {
+		return err
+	}
+	if err := b.expect("ok"); err != nil {
+		return fmt.Errorf("rawmode: %w", err)
+	}
+	return nil
+}
+
+// expect reads the next element and fails if it is not the given one.
+func (b *socketcandBus) expect(want string) error {
+	element, err := b.readElement()
+	if err != nil {
+		return err
+	}
+	if element != want {
+		return fmt.Errorf("unexpected answer '< %s >'", element)
+	}
+	return nil
+}
+
+// readElement reads the next "< ... >" element sent by the server and
+// returns its content without the angle brackets.
+func (b *socketcandBus) readElement() (string, error) {
+	if _, err := b.reader.ReadString('<'); err != nil {
+		return "", err
+	}
+	element, err := b.reader.ReadString('>')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimSuffix(element, ">")), nil
+}
+
+func (b *socketcandBus) writeCommand(cmd string) error {
+	b.txMutex.Lock()
+	defer b.txMutex.Unlock()
+	_, err := fmt.Fprintf(b.conn, "< %s >", cmd)
+	return err
+}
+
+// receive forwards frames sent by the server to the receive channel until
+// the connection is closed.
+func (b *socketcandBus) receive() {
+	defer close(b.rx)
+
+	for {
+		element, err := b.readElement()
+		if err != nil {
+			if !b.closing.Load() {
+				Log(ERROR, "Receiving from socketcand '%s' failed: %v", b.Name(), err)
+			}
+			return
+		}
+
+		fields := strings.Fields(element)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "frame", "error":
+			msg, err := parseSocketcandFrame(fields)
+			if err != nil {
+				if fields[0] == "error" {
+					Log(WARNING, "socketcand '%s': %s", b.Name(), strings.Join(fields[1:], " "))
+				} else {
+					Log(WARNING, "Ignoring malformed socketcand frame '< %s >': %v", element, err)
+				}
+				continue
+			}
+			b.rx <- msg
+		case "ok":
+		default:
+			Log(DEBUG, "Ignoring socketcand message '< %s >'", element)
+		}
+	}
+}
+
+// parseSocketcandFrame decodes a "< frame id sec.usec data >" element or the
+// "< error class sec.usec >" element socketcand sends for error frames.
+func parseSocketcandFrame(fields []string) (CANMessage, error) {
+	if len(fields) < 3 {
+		return CANMessage{}, errors.New("too short")
+	}
+
+	id, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil {
+		return CANMessage{}, fmt.Errorf("invalid ID '%s'", fields[1])
+	}
+	sec, usec, found := strings.Cut(fields[2], ".")
+	if !found {
+		return CANMessage{}, fmt.Errorf("invalid timestamp '%s'", fields[2])
+	}
+	s, err1 := strconv.ParseInt(sec, 10, 64)
+	us, err2 := strconv.ParseInt((usec + "000000")[:6], 10, 64)
+	if err1 != nil || err2 != nil {
+		return CANMessage{}, fmt.Errorf("invalid timestamp '%s'", fields[2])
+	}
+	msg := CANMessage{Timestamp: time.Unix(s, us*1000), TimestampSource: TimestampKernel, Direction: "RX", SentByApp: false}
+
+	if fields[0] == "error" {
+		msg.Frame = Frame{ID: uint32(id) & CAN_ERR_MASK, Length: CAN_ERR_DLC, IsError: true}
+		return msg, nil
+	}
+
+	frame := Frame{ID: uint32(id), IsExtended: len(fields[1]) > 3}
+	var data string
+	if len(fields) > 3 {
+		data = fields[3]
+	}
+	if len(data)%2 != 0 || len(data) > 2*CAN_MAX_DLEN {
+		return CANMessage{}, fmt.Errorf("invalid data '%s'", data)
+	}
+	for i := 0; i < len(data)/2; i++ {
+		v, err := strconv.ParseUint(data[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return CANMessage{}, fmt.Errorf("invalid data '%s'", data)
+		}
+		frame.Data[i] = byte(v)
+	}
+	frame.Length = uint8(len(data) / 2)
+	if err := frame.Validate(); err != nil {
+		return CANMessage{}, err
+	}
+	msg.Frame = frame
+	return msg, nil
+}
+
+func (b *socketcandBus) Receive() <-chan CANMessage {
+	return b.rx
+}
+
+func (b *socketcandBus) Transmit(ctx context.Context, frame Frame) error {
+	if b.conn == nil {
+		return fmt.Errorf("socketcand '%s' is not connected", b.Name())
+	}
+	if frame.IsFD || frame.IsRemote {
+		return fmt.Errorf("socketcand '%s' only sends classic data frames", b.Name())
+	}
+	if err := frame.Validate(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.writeCommand(encodeSocketcandSend(frame))
+}
+
+// encodeSocketcandSend encodes a frame as socketcand send command, e.g.
+// "send 123 2 DE AD".
+func encodeSocketcandSend(frame Frame) string {
+	cmd := "send " + strings.TrimPrefix(formatID(frame.ID, frame.IsExtended), "0x") + " " + strconv.Itoa(int(frame.Length))
+	for _, b := range frame.Payload() {
+		cmd += fmt.Sprintf(" %02X", b)
+	}
+	return cmd
+}
+
+func (b *socketcandBus) Close() error {
+	if b.conn == nil {
+		return nil
+	}
+	b.closing.Store(true)
+	return b.conn.Close()
+}
+
+func (b *socketcandBus) Capabilities() BusCapabilities {
+	return BusCapabilities{Transmit: true, ErrorFrames: true}
+}
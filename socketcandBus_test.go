@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSocketcand is a socketcand server on a local TCP port. It serves one
+// client, opens only the interface can0 and records the commands it gets
+// after the handshake.
+type fakeSocketcand struct {
+	listener net.Listener
+	conn     chan net.Conn // The client connection once the handshake is done
+	commands chan string   // Commands received in raw mode
+}
+
+func newFakeSocketcand(t *testing.T) *fakeSocketcand {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSocketcand{
+		listener: listener,
+		conn:     make(chan net.Conn, 1),
+		commands: make(chan string, 16),
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// serve runs the session with the first client that connects.
+func (s *fakeSocketcand) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	conn.Write([]byte("< hi >"))
+	for {
+		if _, err := reader.ReadString('<'); err != nil {
+			return
+		}
+		element, err := reader.ReadString('>')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(strings.TrimSuffix(element, ">"))
+		switch {
+		case cmd == "open can0":
+			conn.Write([]byte("< ok >"))
+		case strings.HasPrefix(cmd, "open "):
+			conn.Write([]byte("< error could not open bus >"))
+		case cmd == "rawmode":
+			conn.Write([]byte("< ok >"))
+			s.conn <- conn
+		default:
+			s.commands <- cmd
+		}
+	}
+}
+
+// client returns the connection of the client in raw mode.
+func (s *fakeSocketcand) client(t *testing.T) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-s.conn:
+		return conn
+	case <-time.After(time.Second):
+		t.Fatal("client did not enter raw mode")
+	}
+	return nil
+}
+
+func TestParseSocketcandFrame(t *testing.T) {
+	stamp := time.Unix(1700000000, 123456000)
+	tests := []struct {
+		element string
+		frame   Frame
+	}{
+		{"frame 123 1700000000.123456 DEAD", Frame{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}},
+		{"frame 7FF 1700000000.123456 ", Frame{ID: 0x7FF}},
+		{"frame 18FEF100 1700000000.123456 0102030405060708", Frame{ID: 0x18FEF100, Length: 8, Data: [64]byte{1, 2, 3, 4, 5, 6, 7, 8}, IsExtended: true}},
+		{"frame 00000001 1700000000.123456 AA", Frame{ID: 0x1, Length: 1, Data: [64]byte{0xAA}, IsExtended: true}},
+		{"error 20000020 1700000000.123456", Frame{ID: CAN_ERR_ACK, Length: CAN_ERR_DLC, IsError: true}},
+	}
+	for _, tt := range tests {
+		msg, err := parseSocketcandFrame(strings.Fields(tt.element))
+		if err != nil || msg.Frame != tt.frame || !msg.Timestamp.Equal(stamp) || msg.TimestampSource != TimestampKernel {
+			t.Errorf("parse %q = %v at %v, %v, want %v at %v", tt.element, msg.Frame, msg.Timestamp, err, tt.frame, stamp)
+		}
+	}
+}
+
+func TestParseSocketcandFrameMalformed(t *testing.T) {
+	for _, element := range []string{
+		"frame 123",                                              // No timestamp
+		"frame 12X 1700000000.123456 AA",                         // Invalid ID
+		"frame 123 1700000000 AA",                                // Timestamp without microseconds
+		"frame 123 17000x0000.123456 AA",                         // Invalid timestamp
+		"frame 123 1700000000.123456 AAB",                        // Odd number of digits
+		"frame 123 1700000000.123456 ZZ",                         // Invalid data
+		"frame 123 1700000000.123456 " + strings.Repeat("00", 9), // More than 8 bytes
+		"frame 20000000 1700000000.123456 AA",                    // ID exceeds 29 bits
+	} {
+		if msg, err := parseSocketcandFrame(strings.Fields(element)); err == nil {
+			t.Errorf("parse %q = %v, want an error", element, msg.Frame)
+		}
+	}
+}
+
+func TestEncodeSocketcandSend(t *testing.T) {
+	tests := []struct {
+		frame Frame
+		cmd   string
+	}{
+		{Frame{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}, "send 123 2 DE AD"},
+		{Frame{ID: 0x7FF}, "send 7FF 0"},
+		{Frame{ID: 0x18FEF100, Length: 1, Data: [64]byte{0x42}, IsExtended: true}, "send 18FEF100 1 42"},
+	}
+	for _, tt := range tests {
+		if got := encodeSocketcandSend(tt.frame); got != tt.cmd {
+			t.Errorf("encode %v = %q, want %q", tt.frame, got, tt.cmd)
+		}
+	}
+}
+
+func TestSocketcandBusRoundTrip(t *testing.T) {
+	server := newFakeSocketcand(t)
+	bus, err := newBus("socketcand://" + server.listener.Addr().String() + "/can0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if bus.Name() != "can0@127.0.0.1" {
+		t.Errorf("name = %q, want can0@127.0.0.1", bus.Name())
+	}
+	client := server.client(t)
+
+	frame := Frame{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}
+	if err := bus.Transmit(context.Background(), frame); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cmd := <-server.commands:
+		if cmd != "send 123 2 DE AD" {
+			t.Errorf("got command %q, want %q", cmd, "send 123 2 DE AD")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no send command received")
+	}
+	if err := bus.Transmit(context.Background(), Frame{ID: 0x1, IsRemote: true}); err == nil {
+		t.Error("remote frame sent")
+	}
+
+	// Answers and unknown elements are skipped, malformed frames too
+	client.Write([]byte("< ok >< echo >< frame 12X 1.0 AA >< frame 18FEF100 1700000000.5 BEEF >"))
+	msg := nextMessage(t, bus.Receive())
+	want := Frame{ID: 0x18FEF100, Length: 2, Data: [64]byte{0xBE, 0xEF}, IsExtended: true}
+	if msg.Frame != want || !msg.Timestamp.Equal(time.Unix(1700000000, 500000000)) {
+		t.Errorf("received %v at %v, want %v", msg.Frame, msg.Timestamp, want)
+	}
+
+	// The receive channel is closed when the server goes away
+	client.Close()
+	select {
+	case _, ok := <-bus.Receive():
+		if ok {
+			t.Error("unexpected message after the connection was closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("receive channel not closed")
+	}
+}
+
+func TestSocketcandBusOpenUnknownInterface(t *testing.T) {
+	server := newFakeSocketcand(t)
+	bus, err := newBus("socketcand://" + server.listener.Addr().String() + "/vcan9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bus.Open(context.Background())
+	if err == nil {
+		bus.Close()
+		t.Fatal("opened an interface the server does not have")
+	}
+	if !strings.Contains(err.Error(), "open vcan9") {
+		t.Errorf("error = %v, want it to name the interface", err)
+	}
+}
@@ -15,10 +15,18 @@ const messagesFileName = "messages.json"
 // because time.Duration and uuid.UUID don't directly support it.
 type sendMessageJSON struct {
 	UUID        string `json:"uuid"`
+	Channel     string `json:"channel,omitempty"`
 	ID          uint32 `json:"id"`
+	Extended    bool   `json:"extended"`
+	Remote      bool   `json:"remote"`
+	FD          bool   `json:"fd"`
+	BRS         bool   `json:"brs"`
+	ESI         bool   `json:"esi"`
 	DLC         uint8  `json:"dlc"`
 	CycleTimeMs int64  `json:"cycle_time_ms"`
 	Data        []byte `json:"data"`
+	AutoReply   bool   `json:"auto_reply"`
+	AutoReplyID uint32 `json:"auto_reply_id"`
 }
 
 func saveMessages(messages []*SendMessage) {
@@ -26,10 +34,18 @@ func saveMessages(messages []*SendMessage) {
 	for _, msg := range messages {
 		jsonMessages = append(jsonMessages, sendMessageJSON{
 			UUID:        msg.UUID.String(),
+			Channel:     msg.Channel,
 			ID:          msg.ID,
+			Extended:    msg.Extended,
+			Remote:      msg.Remote,
+			FD:          msg.FD,
+			BRS:         msg.BRS,
+			ESI:         msg.ESI,
 			DLC:         msg.DLC,
 			CycleTimeMs: msg.CycleTime.Milliseconds(),
 			Data:        msg.Data,
+			AutoReply:   msg.AutoReply,
+			AutoReplyID: msg.AutoReplyID,
 		})
 	}
 
@@ -69,11 +85,18 @@ func loadMessages() ([]*SendMessage, error) {
 		}
 		messages = append(messages, &SendMessage{
 			UUID:        u,
+			Channel:     jsonMsg.Channel,
 			ID:          jsonMsg.ID,
+			Extended:    jsonMsg.Extended,
+			Remote:      jsonMsg.Remote,
+			FD:          jsonMsg.FD,
+			BRS:         jsonMsg.BRS,
+			ESI:         jsonMsg.ESI,
 			DLC:         jsonMsg.DLC,
 			CycleTime:   time.Duration(jsonMsg.CycleTimeMs) * time.Millisecond,
 			Data:        jsonMsg.Data,
-			done:        make(chan bool), // Re-initialize channel
+			AutoReply:   jsonMsg.AutoReply,
+			AutoReplyID: jsonMsg.AutoReplyID,
 		})
 	}
 
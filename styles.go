@@ -12,4 +12,6 @@ var (
 	rxStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("2")) // Green
 	txStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1")) // Red
 	detailViewHeaderStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("1")).Padding(0, 1).Align(lipgloss.Center)
+	focusedToggleStyle    = lipgloss.NewStyle().Reverse(true)
+	formErrorStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("1")) // Red
 )
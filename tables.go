@@ -5,15 +5,50 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-func newReceiveTable() table.Model {
+// minDataColumnWidth fits the eight data bytes of a classic CAN frame.
+const minDataColumnWidth = 24
+
+// fitDataColumn gives the "Data" column of the table all horizontal space
+// not used by the other columns, so long CAN FD payloads show as many bytes
+// as possible before they are truncated.
+func fitDataColumn(t *table.Model, width int) {
+	columns := t.Columns()
+	dataIndex := -1
+	used := 0
+	for i, col := range columns {
+		if col.Title == "Data" {
+			dataIndex = i
+			continue
+		}
+		if col.Width > 0 {
+			used += col.Width + 2 // Cells have one character of padding on each side
+		}
+	}
+	if dataIndex < 0 {
+		return
+	}
+	columns[dataIndex].Width = max(minDataColumnWidth, width-used-2)
+	t.SetColumns(columns)
+}
+
+// newReceiveTable creates the receive table. withNames adds the "Name"
+// column for the message names of a DBC database after the ID.
+func newReceiveTable(withNames bool) table.Model {
 	receiveColumns := []table.Column{
 		{Title: "", Width: 3},
-		{Title: "ID", Width: 8},
-		{Title: "DLC", Width: 4},
-		{Title: "Cycle Time", Width: 14},
-		{Title: "Data", Width: 24},
-		{Title: "Timestamp", Width: 12},
+		{Title: "Channel", Width: 10},
+		{Title: "ID", Width: 11},
 	}
+	if withNames {
+		receiveColumns = append(receiveColumns, table.Column{Title: "Name", Width: 24})
+	}
+	receiveColumns = append(receiveColumns,
+		table.Column{Title: "DLC", Width: 4},
+		table.Column{Title: "Type", Width: 10},
+		table.Column{Title: "Cycle Time", Width: 14},
+		table.Column{Title: "Data", Width: minDataColumnWidth},
+		table.Column{Title: "Timestamp", Width: 15},
+	)
 
 	receiveTable := table.New(
 		table.WithColumns(receiveColumns),
@@ -30,11 +65,15 @@ func newSendTable() table.Model {
 	sendColumns := []table.Column{
 		{Title: "UUID", Width: 0},
 		{Title: "", Width: 3},
-		{Title: "ID", Width: 8},
+		{Title: "Channel", Width: 10},
+		{Title: "ID", Width: 11},
 		{Title: "DLC", Width: 4},
+		{Title: "Type", Width: 10},
 		{Title: "Cycle Time", Width: 14},
-		{Title: "Data", Width: 24},
+		{Title: "Data", Width: minDataColumnWidth},
 		{Title: "Trigger", Width: 10},
+		{Title: "Errors", Width: 6},
+		{Title: "Status", Width: 32},
 	}
 
 	sendTable := table.New(
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// traceTestStart is the time of the first message of traceTestMessages.
+var traceTestStart = time.Date(2026, 10, 16, 23, 5, 1, 250_000_000, time.Local)
+
+// traceTestMessages returns the messages written by the round trip tests of
+// the trace formats: classic, extended, remote, CAN FD and error frames on
+// two channels in both directions. The offsets are exact binary fractions of
+// a second.
+func traceTestMessages() []CANMessage {
+	fd := Frame{ID: 0x18DAF110, Length: 64, IsExtended: true, IsFD: true, BRS: true, ESI: true}
+	for i := range fd.Length {
+		fd.Data[i] = i
+	}
+	ackError := Frame{ID: CAN_ERR_ACK | CAN_ERR_PROT, Length: CAN_ERR_DLC, IsError: true}
+	ackError.Data[2] = 0x80 // Error while sending
+	ackError.Data[3] = 0x19 // In the ACK slot
+	start := traceTestStart
+	return []CANMessage{
+		{Frame: Frame{ID: 0x123, Length: 2, Data: [64]byte{0xDE, 0xAD}}, Channel: "can0", Timestamp: start, Direction: "RX"},
+		{Frame: Frame{ID: 0x18FEF100, Length: 8, Data: [64]byte{1, 2, 3, 4, 5, 6, 7, 8}, IsExtended: true}, Channel: "can1", Timestamp: start.Add(500 * time.Millisecond), Direction: "TX"},
+		{Frame: Frame{ID: 0x7FF, Length: 4, IsRemote: true}, Channel: "can0", Timestamp: start.Add(time.Second), Direction: "RX"},
+		{Frame: fd, Channel: "can1", Timestamp: start.Add(2250 * time.Millisecond), Direction: "RX"},
+		{Frame: ackError, Channel: "can0", Timestamp: start.Add(3 * time.Second), Direction: "RX"},
+	}
+}
+
+// writeTrace writes messages with a trace writer and returns the file.
+func writeTrace(t *testing.T, newWriter func(io.Writer) traceWriter, messages []CANMessage) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := newWriter(&buf)
+	for _, msg := range messages {
+		if err := writer.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// roundTripTrace writes traceTestMessages in a trace format and returns the
+// messages read back.
+func roundTripTrace(t *testing.T, newWriter func(io.Writer) traceWriter, newReader func(io.Reader) traceReader) []CANMessage {
+	t.Helper()
+	trace := writeTrace(t, newWriter, traceTestMessages())
+	return readAllMessages(t, newReader(bytes.NewReader(trace)))
+}
+
+// readAllMessages reads a trace until io.EOF or a read error, skipping
+// broken entries like the replay bus does. It fails if the reader does not
+// end.
+func readAllMessages(t *testing.T, reader traceReader) []CANMessage {
+	t.Helper()
+	var messages []CANMessage
+	for i := 0; i < 10000; i++ {
+		msg, err := reader.ReadMessage()
+		if err == io.EOF {
+			return messages
+		}
+		if err == nil {
+			messages = append(messages, msg)
+		}
+	}
+	t.Fatal("reader did not reach the end of the trace")
+	return nil
+}
+
+// checkMessages compares the frames, channels, directions and timestamps of
+// messages read from a trace with the written ones.
+func checkMessages(t *testing.T, got, want []CANMessage) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Frame != w.Frame || g.Channel != w.Channel || g.Direction != w.Direction || !g.Timestamp.Equal(w.Timestamp) {
+			t.Errorf("message %d: got %v on %s %s at %v, want %v on %s %s at %v", i,
+				g.Frame, g.Channel, g.Direction, g.Timestamp, w.Frame, w.Channel, w.Direction, w.Timestamp)
+		}
+		if g.TimestampSource != TimestampReplay {
+			t.Errorf("message %d: timestamp source = %s, want %s", i, g.TimestampSource, TimestampReplay)
+		}
+	}
+}
+
+// expectReadError checks that the second entry of a trace with three entries
+// fails to read while the others are still read.
+func expectReadError(t *testing.T, reader traceReader) {
+	t.Helper()
+	if _, err := reader.ReadMessage(); err != nil {
+		t.Fatalf("first entry: %v", err)
+	}
+	if msg, err := reader.ReadMessage(); err == nil || err == io.EOF {
+		t.Fatalf("broken entry read as %v, %v", msg.Frame, err)
+	}
+	if _, err := reader.ReadMessage(); err != nil {
+		t.Fatalf("entry after the broken one: %v", err)
+	}
+	if _, err := reader.ReadMessage(); err != io.EOF {
+		t.Fatalf("got %v at the end of the trace, want io.EOF", err)
+	}
+}
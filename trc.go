@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trcColumns are the columns of TRC 2.1 files written by trcWriter: message
+// number, time offset, type, bus, ID, direction, reserved, DLC and data.
+const trcColumns = "N,O,T,B,I,d,R,L,D"
+
+// trcEpoch is the base of the OLE automation date in the $STARTTIME header,
+// which counts days since 1899-12-30 in local time.
+var trcEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// PEAK error frame types in the first data byte of "ER" records.
+const (
+	trcErrorBit   = 0x01
+	trcErrorForm  = 0x02
+	trcErrorStuff = 0x04
+	trcErrorOther = 0x08
+)
+
+// trcStartTime converts t to the OLE automation date of $STARTTIME.
+func trcStartTime(t time.Time) float64 {
+	y, mo, d := t.Date()
+	h, mi, s := t.Clock()
+	wall := time.Date(y, mo, d, h, mi, s, t.Nanosecond(), time.UTC)
+	return wall.Sub(trcEpoch).Hours() / 24
+}
+
+// parseTRCStartTime converts the OLE automation date of $STARTTIME to a
+// local time.
+func parseTRCStartTime(s string) (time.Time, error) {
+	days, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	wall := trcEpoch.Add(time.Duration(days * 24 * float64(time.Hour))).Round(time.Microsecond)
+	y, mo, d := wall.Date()
+	h, mi, sec := wall.Clock()
+	return time.Date(y, mo, d, h, mi, sec, wall.Nanosecond(), time.Local), nil
+}
+
+// trcWriter writes messages as PEAK TRC 2.1 trace. Time offsets are relative
+// to the first message and buses are numbered from 1 in the order they
+// appear.
+type trcWriter struct {
+	w      *bufio.Writer
+	start  time.Time
+	number int
+	buses  map[string]int
+}
+
+func newTRCWriter(w io.Writer) traceWriter {
+	return &trcWriter{w: bufio.NewWriter(w), buses: make(map[string]int)}
+}
+
+// writeHeader writes the file header with the start time of the trace.
+func (t *trcWriter) writeHeader(start time.Time) {
+	t.start = start
+	fmt.Fprintf(t.w, ";$FILEVERSION=2.1\n")
+	fmt.Fprintf(t.w, ";$STARTTIME=%.10f\n", trcStartTime(start))
+	fmt.Fprintf(t.w, ";$COLUMNS=%s\n", trcColumns)
+	fmt.Fprintf(t.w, ";\n")
+	fmt.Fprintf(t.w, ";   Start time: %s.%d\n", start.Format("02.01.2006 15:04:05.000"), start.Nanosecond()/100000%10)
+	fmt.Fprintf(t.w, ";   Generated by NerdCAN\n")
+	fmt.Fprintf(t.w, ";-------------------------------------------------------------------------------\n")
+	fmt.Fprintf(t.w, ";   Message   Time    Type ID     Rx/Tx\n")
+	fmt.Fprintf(t.w, ";   Number    Offset  |    Bus    [hex]  |  Reserved\n")
+	fmt.Fprintf(t.w, ";   |         [ms]    |    |      |      |  |  Data Length Code\n")
+	fmt.Fprintf(t.w, ";   |         |       |    |      |      |  |  |    Data [hex] ...\n")
+	fmt.Fprintf(t.w, ";   |         |       |    |      |      |  |  |    |\n")
+	fmt.Fprintf(t.w, ";---+-- ------+------ +- --+-- ----+--- +- -+ -+ -- -- -- -- -- -- --\n")
+}
+
+// bus returns the TRC bus number of a channel name.
+func (t *trcWriter) bus(name string) int {
+	n, ok := t.buses[name]
+	if !ok {
+		n = len(t.buses) + 1
+		t.buses[name] = n
+		fmt.Fprintf(t.w, ";   Bus %d: %s\n", n, name)
+	}
+	return n
+}
+
+func (t *trcWriter) WriteMessage(msg CANMessage) error {
+	if t.start.IsZero() {
+		t.writeHeader(msg.Timestamp)
+	}
+	bus := t.bus(msg.Channel)
+	t.number++
+	offset := float64(msg.Timestamp.Sub(t.start)) / float64(time.Millisecond)
+	frame := msg.Frame
+
+	direction := "Rx"
+	if msg.Direction == "TX" {
+		direction = "Tx"
+	}
+	id := fmt.Sprintf("%04X", frame.ID)
+	if frame.IsExtended {
+		id = fmt.Sprintf("%08X", frame.ID)
+	}
+	dlc := frame.DLC()
+	payload := frame.Payload()
+	if frame.IsError {
+		id = "-"
+		payload = trcErrorData(frame)
+		dlc = uint8(len(payload))
+	}
+	data := make([]string, len(payload))
+	for i, b := range payload {
+		data[i] = fmt.Sprintf("%02X", b)
+	}
+
+	line := fmt.Sprintf("%7d %13.3f %-2s %2d %8s %s - %2d    %s",
+		t.number, offset, trcType(frame), bus, id, direction, dlc, strings.Join(data, " "))
+	_, err := t.w.WriteString(strings.TrimRight(line, " ") + "\n")
+	return err
+}
+
+func (t *trcWriter) Close() error {
+	if t.start.IsZero() {
+		t.writeHeader(time.Now())
+	}
+	return t.w.Flush()
+}
+
+// trcType returns the TRC 2.x message type of a frame.
+func trcType(frame Frame) string {
+	switch {
+	case frame.IsError:
+		return "ER"
+	case frame.IsRemote:
+		return "RR"
+	case frame.IsFD && frame.BRS && frame.ESI:
+		return "BI"
+	case frame.IsFD && frame.BRS:
+		return "FB"
+	case frame.IsFD && frame.ESI:
+		return "FE"
+	case frame.IsFD:
+		return "FD"
+	default:
+		return "DT"
+	}
+}
+
+// trcErrorData converts a SocketCAN error frame to the five data bytes of a
+// PEAK error record: error type, direction, error code capture and the RX
+// and TX error counters.
+func trcErrorData(frame Frame) []byte {
+	e := decodeCANError(frame)
+	var errorType uint8
+	switch {
+	case e.Protocol&0x01 != 0:
+		errorType = trcErrorBit
+	case e.Protocol&0x02 != 0:
+		errorType = trcErrorForm
+	case e.Protocol&0x04 != 0:
+		errorType = trcErrorStuff
+	default:
+		errorType = trcErrorOther
+	}
+	var direction uint8 = 1 // Error while receiving
+	if e.Protocol&0x80 != 0 {
+		direction = 0
+	}
+	return []byte{errorType, direction, e.Location, e.RxErrorCounter, e.TxErrorCounter}
+}
+
+// trcErrorFrame converts the data bytes of a PEAK error record to a
+// SocketCAN error frame.
+func trcErrorFrame(data []byte) Frame {
+	frame := Frame{ID: CAN_ERR_PROT | CAN_ERR_BUSERROR, Length: CAN_ERR_DLC, IsError: true}
+	if len(data) < 5 {
+		return frame
+	}
+	switch data[0] {
+	case trcErrorBit:
+		frame.Data[2] = 0x01
+	case trcErrorForm:
+		frame.Data[2] = 0x02
+	case trcErrorStuff:
+		frame.Data[2] = 0x04
+	}
+	if data[1] == 0 {
+		frame.Data[2] |= 0x80
+	}
+	frame.Data[3] = data[2] & 0x1F
+	frame.ID |= CAN_ERR_CNT
+	frame.Data[6] = data[4]
+	frame.Data[7] = data[3]
+	return frame
+}
+
+// trcReader reads PEAK TRC trace files of version 1.x and 2.x.
+type trcReader struct {
+	scanner *bufio.Scanner
+	version string
+	start   time.Time
+	columns map[byte]int      // Index of each column of a 2.x record
+	buses   map[string]string // Channel names from ";   Bus N: name" comments
+}
+
+func newTRCReader(r io.Reader) traceReader {
+	return &trcReader{scanner: bufio.NewScanner(r), version: "1.1", buses: make(map[string]string)}
+}
+
+// ReadMessage returns the next CAN frame of the trace. Comments, status
+// records and events are skipped.
+func (t *trcReader) ReadMessage() (CANMessage, error) {
+	for t.scanner.Scan() {
+		line := strings.TrimSpace(t.scanner.Text())
+		if strings.HasPrefix(line, ";$") {
+			if err := t.parseHeader(line[2:]); err != nil {
+				return CANMessage{}, err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			// Channel names written by trcWriter
+			if fields := strings.Fields(line[1:]); len(fields) == 3 && fields[0] == "Bus" {
+				t.buses[strings.TrimSuffix(fields[1], ":")] = fields[2]
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		var msg CANMessage
+		var ok bool
+		var err error
+		if strings.HasPrefix(t.version, "1.") {
+			msg, ok, err = t.parseV1(strings.Fields(line))
+		} else {
+			msg, ok, err = t.parseV2(strings.Fields(line))
+		}
+		if err != nil {
+			return CANMessage{}, fmt.Errorf("%w in line '%s'", err, line)
+		}
+		if ok {
+			if name, ok := t.buses[msg.Channel]; ok {
+				msg.Channel = name
+			}
+			msg.TimestampSource = TimestampReplay
+			return msg, nil
+		}
+	}
+	if err := t.scanner.Err(); err != nil {
+		return CANMessage{}, fmt.Errorf("%w: %w", errTraceRead, err)
+	}
+	return CANMessage{}, io.EOF
+}
+
+// parseHeader parses a ";$KEY=VALUE" header line.
+func (t *trcReader) parseHeader(header string) error {
+	key, value, _ := strings.Cut(header, "=")
+	switch key {
+	case "FILEVERSION":
+		t.version = value
+		if !strings.HasPrefix(value, "1.") && !strings.HasPrefix(value, "2.") {
+			return fmt.Errorf("unsupported TRC version %s", value)
+		}
+		if value == "2.0" && t.columns == nil {
+			t.setColumns("N,O,T,I,d,l,D")
+		}
+	case "STARTTIME":
+		start, err := parseTRCStartTime(value)
+		if err != nil {
+			return fmt.Errorf("invalid start time '%s'", value)
+		}
+		t.start = start
+	case "COLUMNS":
+		t.setColumns(value)
+	}
+	return nil
+}
+
+func (t *trcReader) setColumns(columns string) {
+	t.columns = make(map[byte]int)
+	for i, column := range strings.Split(columns, ",") {
+		if column != "" {
+			t.columns[column[0]] = i
+		}
+	}
+}
+
+// timestamp returns the time of a record from its offset in milliseconds.
+func (t *trcReader) timestamp(offset string) (time.Time, error) {
+	ms, err := strconv.ParseFloat(offset, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time offset '%s'", offset)
+	}
+	return t.start.Add(time.Duration(ms * float64(time.Millisecond))), nil
+}
+
+// parseV1 parses a record of a 1.x trace, e.g.
+// "1)  1059.9  Rx  0300  8  00 00 00 00 00 00 00 00". Version 1.0 traces
+// have no direction column and only contain received frames.
+func (t *trcReader) parseV1(fields []string) (msg CANMessage, ok bool, err error) {
+	if len(fields) < 4 || !strings.HasSuffix(fields[0], ")") {
+		return msg, false, nil
+	}
+	timestamp, err := t.timestamp(fields[1])
+	if err != nil {
+		return msg, false, err
+	}
+	msg = CANMessage{Channel: "1", Timestamp: timestamp, Direction: "RX"}
+
+	rest := fields[2:]
+	switch rest[0] {
+	case "Rx", "Tx":
+		msg.Direction = strings.ToUpper(rest[0])
+		rest = rest[1:]
+	case "Warng", "Error":
+		return msg, false, nil // Status records
+	}
+	if len(rest) < 2 {
+		return msg, false, fmt.Errorf("truncated record")
+	}
+	frame, err := parseTRCID(rest[0])
+	if err != nil {
+		return msg, false, err
+	}
+	length, err := strconv.ParseUint(rest[1], 10, 8)
+	if err != nil || length > CAN_MAX_DLEN {
+		return msg, false, fmt.Errorf("invalid DLC '%s'", rest[1])
+	}
+	frame.Length = uint8(length)
+	if len(rest) > 2 && rest[2] == "RTR" {
+		frame.IsRemote = true
+	} else if err := parseTRCData(&frame, rest[2:]); err != nil {
+		return msg, false, err
+	}
+	if err := frame.Validate(); err != nil {
+		return msg, false, err
+	}
+	msg.Frame = frame
+	return msg, true, nil
+}
+
+// parseV2 parses a record of a 2.x trace using the columns of the header.
+func (t *trcReader) parseV2(fields []string) (msg CANMessage, ok bool, err error) {
+	if t.columns == nil {
+		t.setColumns(trcColumns)
+	}
+	column := func(c byte) string {
+		i, ok := t.columns[c]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return fields[i]
+	}
+	// The data column holds the remaining fields
+	var data []string
+	if i, ok := t.columns['D']; ok && i < len(fields) {
+		data = fields[i:]
+	}
+
+	recordType := column('T')
+	switch recordType {
+	case "DT", "FD", "FB", "FE", "BI", "RR", "ER":
+	default:
+		return msg, false, nil // Status, error counter and event records
+	}
+	timestamp, err := t.timestamp(column('O'))
+	if err != nil {
+		return msg, false, err
+	}
+	msg = CANMessage{Channel: "1", Timestamp: timestamp, Direction: "RX"}
+	if bus := column('B'); bus != "" {
+		msg.Channel = bus
+	}
+	if column('d') == "Tx" {
+		msg.Direction = "TX"
+	}
+
+	if recordType == "ER" {
+		payload := make([]byte, 0, len(data))
+		for _, field := range data {
+			b, err := strconv.ParseUint(field, 16, 8)
+			if err != nil {
+				return msg, false, fmt.Errorf("invalid data byte '%s'", field)
+			}
+			payload = append(payload, byte(b))
+		}
+		msg.Frame = trcErrorFrame(payload)
+		return msg, true, nil
+	}
+
+	frame, err := parseTRCID(column('I'))
+	if err != nil {
+		return msg, false, err
+	}
+	frame.IsFD = recordType != "DT" && recordType != "RR"
+	frame.BRS = recordType == "FB" || recordType == "BI"
+	frame.ESI = recordType == "FE" || recordType == "BI"
+	frame.IsRemote = recordType == "RR"
+
+	var length uint64
+	if l := column('l'); l != "" {
+		length, err = strconv.ParseUint(l, 10, 8)
+	} else {
+		length, err = strconv.ParseUint(column('L'), 10, 8)
+		if err == nil && frame.IsFD {
+			length = uint64(fdDLCToLength(uint8(length)))
+		}
+	}
+	if err != nil || length > CANFD_MAX_DLEN {
+		return msg, false, fmt.Errorf("invalid data length")
+	}
+	frame.Length = uint8(length)
+	if !frame.IsRemote {
+		if err := parseTRCData(&frame, data); err != nil {
+			return msg, false, err
+		}
+	}
+	if err := frame.Validate(); err != nil {
+		return msg, false, err
+	}
+	msg.Frame = frame
+	return msg, true, nil
+}
+
+// parseTRCID parses a hexadecimal identifier, identifiers with more than
+// four digits are extended.
+func parseTRCID(s string) (Frame, error) {
+	id, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return Frame{}, fmt.Errorf("invalid ID '%s'", s)
+	}
+	return Frame{ID: uint32(id), IsExtended: len(s) > 4}, nil
+}
+
+// parseTRCData reads frame.Length data bytes from fields.
+func parseTRCData(frame *Frame, fields []string) error {
+	if len(fields) < int(frame.Length) {
+		return fmt.Errorf("missing data bytes")
+	}
+	payload, err := hex.DecodeString(strings.Join(fields[:frame.Length], ""))
+	if err != nil || len(payload) != int(frame.Length) {
+		return fmt.Errorf("invalid data bytes")
+	}
+	copy(frame.Data[:], payload)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTRCRoundTrip(t *testing.T) {
+	messages := traceTestMessages()
+	got := roundTripTrace(t, newTRCWriter, newTRCReader)
+	if len(got) == 0 {
+		t.Fatal("no messages read")
+	}
+	// $STARTTIME is a fraction of days and only exact to a few microseconds,
+	// the offsets of the records are exact
+	if diff := got[0].Timestamp.Sub(traceTestStart).Abs(); diff > 10*time.Microsecond {
+		t.Errorf("start time %v, want %v", got[0].Timestamp, traceTestStart)
+	}
+	want := make([]CANMessage, len(messages))
+	for i, msg := range messages {
+		want[i] = msg
+		want[i].Timestamp = got[0].Timestamp.Add(msg.Timestamp.Sub(traceTestStart))
+	}
+	// PEAK error records keep the type, direction, position and counters
+	want[4].Frame = Frame{ID: CAN_ERR_PROT | CAN_ERR_BUSERROR | CAN_ERR_CNT, Length: CAN_ERR_DLC, IsError: true}
+	want[4].Frame.Data[2] = 0x80
+	want[4].Frame.Data[3] = 0x19
+	checkMessages(t, got, want)
+}
+
+func TestTRCErrorRecord(t *testing.T) {
+	stuffError := Frame{ID: CAN_ERR_PROT | CAN_ERR_BUSERROR | CAN_ERR_CNT, Length: CAN_ERR_DLC, IsError: true}
+	stuffError.Data[2] = 0x04 | 0x80 // Stuff error while sending
+	stuffError.Data[3] = 0x19        // In the ACK slot
+	stuffError.Data[6] = 8           // TX error counter
+	stuffError.Data[7] = 2           // RX error counter
+	if got := trcErrorFrame(trcErrorData(stuffError)); got != stuffError {
+		t.Errorf("got %v, want %v", got, stuffError)
+	}
+	if data := trcErrorData(stuffError); string(data) != string([]byte{trcErrorStuff, 0, 0x19, 2, 8}) {
+		t.Errorf("error record data = % X", data)
+	}
+}
+
+func TestTRCVersions(t *testing.T) {
+	fd := Frame{ID: 0x18FEF100, Length: 12, IsExtended: true, IsFD: true, BRS: true}
+	fd.Data[11] = 0xFF
+	type record struct {
+		frame     Frame
+		offset    time.Duration
+		direction string
+	}
+	tests := []struct {
+		name    string
+		trace   []string
+		records []record
+	}{
+		{
+			"1.0 without direction",
+			[]string{
+				";$FILEVERSION=1.0",
+				"     1)      1059.9  0300  2  DE AD",
+				"     2)      1061.0  0123  4  RTR",
+			},
+			[]record{
+				{Frame{ID: 0x300, Length: 2, Data: [64]byte{0xDE, 0xAD}}, 1059900 * time.Microsecond, "RX"},
+				{Frame{ID: 0x123, Length: 4, IsRemote: true}, 1061 * time.Millisecond, "RX"},
+			},
+		},
+		{
+			"1.1 with direction",
+			[]string{
+				";$FILEVERSION=1.1",
+				"     1)      1059.9  Rx      0300  2  DE AD",
+				"     2)      1060.0  Warng   FFFFFFFF  4  00 00 00 08  BUSHEAVY",
+				"     3)      1061.0  Tx  18FEF100  1  42",
+			},
+			[]record{
+				{Frame{ID: 0x300, Length: 2, Data: [64]byte{0xDE, 0xAD}}, 1059900 * time.Microsecond, "RX"},
+				{Frame{ID: 0x18FEF100, Length: 1, Data: [64]byte{0x42}, IsExtended: true}, 1061 * time.Millisecond, "TX"},
+			},
+		},
+		{
+			"2.0 with data length column",
+			[]string{
+				";$FILEVERSION=2.0",
+				"      1      1059.900 DT     0300 Rx 2  DE AD",
+				"      2      1060.000 ST          Rx    00 00 00 04",
+				"      3      1061.000 FB 18FEF100 Tx 12 00 00 00 00 00 00 00 00 00 00 00 FF",
+			},
+			[]record{
+				{Frame{ID: 0x300, Length: 2, Data: [64]byte{0xDE, 0xAD}}, 1059900 * time.Microsecond, "RX"},
+				{fd, 1061 * time.Millisecond, "TX"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAllMessages(t, newTRCReader(strings.NewReader(strings.Join(tt.trace, "\n"))))
+			if len(got) != len(tt.records) {
+				t.Fatalf("got %d messages, want %d", len(got), len(tt.records))
+			}
+			for i, want := range tt.records {
+				msg := got[i]
+				// Without $STARTTIME the offsets count from the zero time
+				offset := msg.Timestamp.Sub(time.Time{})
+				if msg.Frame != want.frame || msg.Direction != want.direction || msg.Channel != "1" || offset.Round(time.Microsecond) != want.offset {
+					t.Errorf("message %d: got %v %s on %s at %v, want %v %s on 1 at %v", i,
+						msg.Frame, msg.Direction, msg.Channel, offset, want.frame, want.direction, want.offset)
+				}
+			}
+		})
+	}
+}
+
+func TestTRCMalformed(t *testing.T) {
+	trace := strings.Join([]string{
+		";$FILEVERSION=2.1",
+		";$STARTTIME=46311.9618200231",
+		";$COLUMNS=" + trcColumns,
+		"      1         0.000 DT  1     0123 Rx -  2    DE AD",
+		"      2         1.000 DT  1     0123 Rx -  2    DE",
+		"      3         2.000 DT  1     0123 Rx -  2    BE EF",
+	}, "\n")
+	expectReadError(t, newTRCReader(strings.NewReader(trace)))
+
+	if _, err := newTRCReader(strings.NewReader(";$FILEVERSION=3.0\n")).ReadMessage(); err == nil {
+		t.Error("unsupported version accepted")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// watchFileName is the file the watch list is saved to, next to
+// messagesFileName.
+const watchFileName = "watch.json"
+
+// watch is a DBC signal shown in the watch pane with the statistics of its
+// values since the last reset.
+type watch struct {
+	Message string // Name of the DBC message
+	Signal  string // Name of the signal in the message
+
+	value      signalValue // Last decoded value, Signal is nil before the first update
+	channel    string      // Channel of the last update
+	lastUpdate time.Time
+	min, max   float64
+	seen       bool // min and max are set
+}
+
+// watchJSON is an entry of the watch list file.
+type watchJSON struct {
+	Message string `json:"message"`
+	Signal  string `json:"signal"`
+}
+
+// update records a decoded value of the signal.
+func (w *watch) update(value signalValue, msg CANMessage) {
+	w.value = value
+	w.channel = msg.Channel
+	w.lastUpdate = msg.Timestamp
+	if !w.seen || value.Physical < w.min {
+		w.min = value.Physical
+	}
+	if !w.seen || value.Physical > w.max {
+		w.max = value.Physical
+	}
+	w.seen = true
+}
+
+// reset forgets the minimum and maximum values.
+func (w *watch) reset() {
+	w.seen = false
+}
+
+// parseWatch parses a signal to watch, "Message.Signal" or a signal name
+// that is unique in the DBC files.
+func parseWatch(s string) (*watch, error) {
+	s = strings.TrimSpace(s)
+	if signalDB == nil {
+		return nil, fmt.Errorf("no DBC files loaded, see -dbc")
+	}
+	if msgName, sigName, ok := strings.Cut(s, "."); ok {
+		msg := signalDB.messageByName(msgName)
+		if msg == nil {
+			return nil, fmt.Errorf("unknown message '%s'", msgName)
+		}
+		for _, sig := range msg.Signals {
+			if sig.Name == sigName {
+				return &watch{Message: msg.Name, Signal: sig.Name}, nil
+			}
+		}
+		return nil, fmt.Errorf("message %s has no signal '%s'", msgName, sigName)
+	}
+
+	var found []*watch
+	for _, msg := range signalDB.messages {
+		for _, sig := range msg.Signals {
+			if sig.Name == s {
+				found = append(found, &watch{Message: msg.Name, Signal: sig.Name})
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("unknown signal '%s'", s)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("signal '%s' is defined in %d messages, use Message.%s", s, len(found), s)
+}
+
+// updateWatches records the values of the watched signals carried by msg.
+// It reports whether any watch was updated.
+func (m *Model) updateWatches(msg CANMessage) bool {
+	dbcMsg := signalDB.message(msg.Frame)
+	if dbcMsg == nil || len(m.watches) == 0 {
+		return false
+	}
+	updated := false
+	for _, value := range dbcMsg.decode(msg.Frame.Payload()) {
+		if !value.Valid {
+			continue
+		}
+		for _, w := range m.watches {
+			if w.Message == dbcMsg.Name && w.Signal == value.Signal.Name {
+				w.update(value, msg)
+				updated = true
+			}
+		}
+	}
+	return updated
+}
+
+// updateWatchTable refreshes the rows of the watch pane.
+func (m *Model) updateWatchTable() {
+	rows := make([]table.Row, len(m.watches))
+	for i, w := range m.watches {
+		rows[i] = table.Row{w.Message, w.Signal, "-", "", "", "-", "-", "-"}
+		if w.value.Signal == nil {
+			continue
+		}
+		sig := w.value.Signal
+		rows[i][2] = sig.formatPhysical(w.value.Physical) + optionalText(w.value.Text)
+		rows[i][3] = sig.Unit
+		rows[i][4] = w.channel
+		rows[i][5] = w.lastUpdate.Format("15:04:05.000")
+		if w.seen {
+			rows[i][6] = sig.formatPhysical(w.min)
+			rows[i][7] = sig.formatPhysical(w.max)
+		}
+	}
+	m.watchTable.SetRows(rows)
+}
+
+func newWatchTable() table.Model {
+	watchColumns := []table.Column{
+		{Title: "Message", Width: 20},
+		{Title: "Signal", Width: 20},
+		{Title: "Value", Width: 20},
+		{Title: "Unit", Width: 8},
+		{Title: "Channel", Width: 10},
+		{Title: "Last Update", Width: 12},
+		{Title: "Min", Width: 10},
+		{Title: "Max", Width: 10},
+	}
+
+	watchTable := table.New(
+		table.WithColumns(watchColumns),
+	)
+
+	watchStyles := table.DefaultStyles()
+	watchStyles.Header = watchStyles.Header.BorderStyle(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("240")).BorderBottom(true).Bold(false)
+	watchStyles.Selected = watchStyles.Selected.Foreground(lipgloss.Color("229")).Background(lipgloss.Color("57")).Bold(false)
+	watchTable.SetStyles(watchStyles)
+	return watchTable
+}
+
+// removeSelectedWatch removes the selected signal from the watch list.
+func (m *Model) removeSelectedWatch() {
+	cursor := m.watchTable.Cursor()
+	if cursor < 0 || cursor >= len(m.watches) {
+		return
+	}
+	m.watches = append(m.watches[:cursor:cursor], m.watches[cursor+1:]...)
+	m.updateWatchTable()
+	saveWatches(m.watches)
+}
+
+// openWatchPrompt starts adding signals to the watch list in the status bar.
+func (m *Model) openWatchPrompt() {
+	m.watchInput = textinput.New()
+	m.watchInput.Prompt = "Watch signals: "
+	m.watchInput.Placeholder = "EngineData.EngineSpeed, CoolantTemp"
+	m.watchInput.Focus()
+	m.watchErr = ""
+	m.addingWatch = true
+}
+
+// updateWatchPrompt handles keys while signals are added to the watch list.
+// enter adds the comma separated signals, esc cancels.
+func updateWatchPrompt(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.addingWatch = false
+		return m, nil
+	case "enter":
+		var added []*watch
+		for _, entry := range strings.Split(m.watchInput.Value(), ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			w, err := parseWatch(entry)
+			if err != nil {
+				m.watchErr = err.Error()
+				return m, nil
+			}
+			added = append(added, w)
+		}
+		m.watches = append(m.watches, added...)
+		m.addingWatch = false
+		m.updateWatchTable()
+		saveWatches(m.watches)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.watchInput, cmd = m.watchInput.Update(msg)
+	m.watchErr = ""
+	return m, cmd
+}
+
+// renderWatchPrompt renders the watch prompt in place of the status bar.
+func (m Model) renderWatchPrompt() string {
+	line := " " + m.watchInput.View()
+	if m.watchErr != "" {
+		line += "  " + formErrorStyle.Render(m.watchErr)
+	}
+	return statusStyle.Width(m.width).Render(line)
+}
+
+func saveWatches(watches []*watch) {
+	jsonWatches := []watchJSON{}
+	for _, w := range watches {
+		jsonWatches = append(jsonWatches, watchJSON{Message: w.Message, Signal: w.Signal})
+	}
+
+	data, err := json.MarshalIndent(jsonWatches, "", "  ")
+	if err != nil {
+		Log(ERROR, "Error marshaling watch list to JSON: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(watchFileName, data, 0644); err != nil {
+		Log(ERROR, "Error writing watch list to file: %v", err)
+	}
+}
+
+func loadWatches() ([]*watch, error) {
+	data, err := os.ReadFile(watchFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var jsonWatches []watchJSON
+	if err := json.Unmarshal(data, &jsonWatches); err != nil {
+		return nil, err
+	}
+
+	var watches []*watch
+	for _, w := range jsonWatches {
+		watches = append(watches, &watch{Message: w.Message, Signal: w.Signal})
+	}
+	return watches, nil
+}
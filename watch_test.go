@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// testWatchDBC defines the signal Counter in two messages.
+const testWatchDBC = `VERSION ""
+
+NS_ :
+
+BS_:
+
+BU_: ECU
+
+BO_ 256 Engine: 8 ECU
+ SG_ Speed : 0|16@1+ (0.1,0) [0|6500] "km/h" Vector__XXX
+ SG_ Counter : 16|4@1+ (1,0) [0|15] "" Vector__XXX
+
+BO_ 257 Brake: 8 ECU
+ SG_ Pressure : 0|16@1+ (0.01,0) [0|250] "bar" Vector__XXX
+ SG_ Counter : 16|4@1+ (1,0) [0|15] "" Vector__XXX
+`
+
+func TestParseWatch(t *testing.T) {
+	useTestDBC(t, testWatchDBC)
+	tests := []struct {
+		entry   string
+		message string
+		signal  string
+		err     string // Part of the error, empty if the entry is valid
+	}{
+		{"Engine.Speed", "Engine", "Speed", ""},
+		{" Speed ", "Engine", "Speed", ""}, // Unique signal names need no message
+		{"Pressure", "Brake", "Pressure", ""},
+		{"Brake.Counter", "Brake", "Counter", ""},
+		{"Counter", "", "", "defined in 2 messages, use Message.Counter"},
+		{"Gearbox.Speed", "", "", "unknown message 'Gearbox'"},
+		{"Engine.Pressure", "", "", "message Engine has no signal 'Pressure'"},
+		{"Engine.", "", "", "message Engine has no signal ''"},
+		{"engine.speed", "", "", "unknown message 'engine'"},
+		{"Torque", "", "", "unknown signal 'Torque'"},
+		{"", "", "", "unknown signal ''"},
+	}
+	for _, tt := range tests {
+		w, err := parseWatch(tt.entry)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parse %q = %v, %v, want error %q", tt.entry, w, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || w.Message != tt.message || w.Signal != tt.signal {
+			t.Errorf("parse %q = %v, %v, want %s.%s", tt.entry, w, err, tt.message, tt.signal)
+		}
+	}
+}
+
+func TestParseWatchWithoutDBC(t *testing.T) {
+	withoutDBC(t)
+	if _, err := parseWatch("Engine.Speed"); err == nil || !strings.Contains(err.Error(), "-dbc") {
+		t.Errorf("error = %v, want a hint to -dbc", err)
+	}
+}
+
+func TestWatchesSaveLoad(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// No watch list saved yet
+	if watches, err := loadWatches(); err != nil || watches != nil {
+		t.Errorf("loaded %v, %v without a file", watches, err)
+	}
+
+	saved := []*watch{{Message: "Engine", Signal: "Speed"}, {Message: "Brake", Signal: "Counter"}}
+	saved[0].update(signalValue{Physical: 42, Valid: true}, CANMessage{Channel: "can0"})
+	saveWatches(saved)
+	watches, err := loadWatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(watches) != len(saved) {
+		t.Fatalf("loaded %d watches, want %d", len(watches), len(saved))
+	}
+	for i, w := range watches {
+		// Only the signals are saved, not their values
+		if w.Message != saved[i].Message || w.Signal != saved[i].Signal || w.seen || w.channel != "" {
+			t.Errorf("watch %d: loaded %+v, want %s.%s", i, w, saved[i].Message, saved[i].Signal)
+		}
+	}
+
+	// An empty list is saved as such
+	saveWatches(nil)
+	if watches, err := loadWatches(); err != nil || len(watches) != 0 {
+		t.Errorf("loaded %v, %v after saving an empty list", watches, err)
+	}
+
+	if err := os.WriteFile(watchFileName, []byte(`{"message": "Engine"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if watches, err := loadWatches(); err == nil {
+		t.Errorf("loaded %v from a broken file", watches)
+	}
+}